@@ -0,0 +1,227 @@
+// Command mockoidc is a minimal OIDC provider for trying single sign-on
+// locally. Every authorization request is approved straight away as the user
+// given by -email, or by the login_hint parameter. Point a provider at it with
+//
+//	OIDC_PROVIDERS=mock
+//	OIDC_MOCK_ISSUER=http://localhost:9000
+//	OIDC_MOCK_CLIENT_ID=echoes-chat
+//	OIDC_MOCK_REDIRECT_URL=http://localhost:8080/api/v1/auth/oidc/mock/callback
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kevinsofyan/echoes-chat-api/internal/oidc"
+	"github.com/kevinsofyan/echoes-chat-api/internal/signing"
+)
+
+type grant struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	email       string
+	expiresAt   time.Time
+}
+
+type server struct {
+	issuer        string
+	email         string
+	name          string
+	emailVerified bool
+	signer        signing.Signer
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL, as configured in OIDC_<NAME>_ISSUER")
+	email := flag.String("email", "dev@example.com", "email of the signed-in user, unless the request has a login_hint")
+	name := flag.String("name", "Dev User", "name of the signed-in user")
+	emailVerified := flag.Bool("email-verified", true, "value of the email_verified claim")
+	flag.Parse()
+
+	signer, err := newSigner()
+	if err != nil {
+		log.Fatal("Failed to create signing key:", err)
+	}
+
+	s := &server{
+		issuer:        *issuer,
+		email:         *email,
+		name:          *name,
+		emailVerified: *emailVerified,
+		signer:        signer,
+		grants:        make(map[string]grant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /authorize", s.authorize)
+	mux.HandleFunc("POST /token", s.token)
+	mux.HandleFunc("GET /jwks", s.jwks)
+
+	log.Printf("Mock OIDC provider %s listening on %s", s.issuer, *addr)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// newSigner creates a throwaway Ed25519 key; tokens from a previous run stop verifying on restart
+func newSigner() (signing.Signer, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := signing.NewKeyFromPEM("mock", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		return nil, err
+	}
+	return signing.NewKeySet(key)
+}
+
+func (s *server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.issuer,
+		"authorization_endpoint":                s.issuer + "/authorize",
+		"token_endpoint":                        s.issuer + "/token",
+		"jwks_uri":                              s.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"EdDSA"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *server) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if query.Get("response_type") != "code" || query.Get("client_id") == "" {
+		http.Error(w, "response_type=code and client_id are required", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	email := query.Get("login_hint")
+	if email == "" {
+		email = s.email
+	}
+
+	code := randomString()
+	s.mu.Lock()
+	s.grants[code] = grant{
+		clientID:    query.Get("client_id"),
+		redirectURI: redirectURI.String(),
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		email:       email,
+		expiresAt:   time.Now().Add(time.Minute),
+	}
+	s.mu.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	clientID := r.PostForm.Get("client_id")
+	if user, _, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(user)
+	}
+
+	// Codes are single-use whether or not the exchange succeeds
+	s.mu.Lock()
+	g, ok := s.grants[r.PostForm.Get("code")]
+	delete(s.grants, r.PostForm.Get("code"))
+	s.mu.Unlock()
+
+	challenge := oidc.CodeChallenge(r.PostForm.Get("code_verifier"))
+	if !ok || time.Now().After(g.expiresAt) || g.clientID != clientID ||
+		g.redirectURI != r.PostForm.Get("redirect_uri") ||
+		subtle.ConstantTimeCompare([]byte(challenge), []byte(g.challenge)) != 1 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	sum := sha256.Sum256([]byte(g.email))
+	now := time.Now()
+	idToken, err := s.signer.Sign(jwt.MapClaims{
+		"iss":                s.issuer,
+		"sub":                hex.EncodeToString(sum[:8]),
+		"aud":                g.clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              g.nonce,
+		"email":              g.email,
+		"email_verified":     s.emailVerified,
+		"name":               s.name,
+		"preferred_username": g.email,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (s *server) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.signer.JWKS())
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"net"
 	"os"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"github.com/kevinsofyan/echoes-chat-api/internal/container"
@@ -39,10 +42,18 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	c := container.NewContainer(db)
+	c, err := container.NewContainer(db)
+	if err != nil {
+		log.Fatal("Failed to initialize:", err)
+	}
 	e := echo.New()
+	if e.IPExtractor, err = ipExtractorFromEnv(); err != nil {
+		log.Fatal("Failed to initialize:", err)
+	}
 	go c.Hub.Run()
-	routes.SetupRoutes(e, c.Handlers)
+	go c.MediaProcessor.Run()
+	go c.UploadService.RunCleanup()
+	routes.SetupRoutes(e, c.Handlers, c.Middlewares)
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -55,3 +66,28 @@ func main() {
 		log.Fatal("Failed to start server:", err)
 	}
 }
+
+// ipExtractorFromEnv decides where client addresses come from. Forwarding
+// headers can be set by anyone, so they're only read when they were added by a
+// proxy listed in TRUSTED_PROXIES (comma-separated CIDRs); otherwise the
+// address of the connection is used. Login throttling and session records rely on it.
+func ipExtractorFromEnv() (echo.IPExtractor, error) {
+	spec := strings.TrimSpace(os.Getenv("TRUSTED_PROXIES"))
+	if spec == "" {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, cidr := range strings.Split(spec, ",") {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q: %w", cidr, err)
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
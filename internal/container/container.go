@@ -1,51 +1,152 @@
 package container
 
 import (
+	"fmt"
+
 	"github.com/kevinsofyan/echoes-chat-api/internal/handlers"
+	"github.com/kevinsofyan/echoes-chat-api/internal/mailer"
+	"github.com/kevinsofyan/echoes-chat-api/internal/middleware"
+	"github.com/kevinsofyan/echoes-chat-api/internal/oidc"
+	"github.com/kevinsofyan/echoes-chat-api/internal/ratelimit"
 	"github.com/kevinsofyan/echoes-chat-api/internal/repositories"
 	"github.com/kevinsofyan/echoes-chat-api/internal/routes"
+	"github.com/kevinsofyan/echoes-chat-api/internal/scanner"
+	"github.com/kevinsofyan/echoes-chat-api/internal/secretbox"
 	"github.com/kevinsofyan/echoes-chat-api/internal/services"
+	"github.com/kevinsofyan/echoes-chat-api/internal/signing"
+	"github.com/kevinsofyan/echoes-chat-api/internal/storage"
 	"github.com/kevinsofyan/echoes-chat-api/internal/websocket"
 	"gorm.io/gorm"
 )
 
 type Container struct {
-	Handlers *routes.Handlers
-	Hub      *websocket.Hub
+	Handlers       *routes.Handlers
+	Middlewares    *routes.Middlewares
+	Hub            *websocket.Hub
+	MediaProcessor services.MediaProcessor
+	UploadService  services.UploadService
 }
 
-func NewContainer(db *gorm.DB) *Container {
+func NewContainer(db *gorm.DB) (*Container, error) {
 	// Initialize repositories
 	userRepo := repositories.NewUserRepository(db)
 	tokenRepo := repositories.NewTokenRepository(db)
+	refreshTokenRepo := repositories.NewRefreshTokenRepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+	passwordResetRepo := repositories.NewPasswordResetRepository(db)
+	emailVerificationRepo := repositories.NewEmailVerificationRepository(db)
+	recoveryCodeRepo := repositories.NewRecoveryCodeRepository(db)
+	twoFactorChallengeRepo := repositories.NewTwoFactorChallengeRepository(db)
+	loginFailureRepo := repositories.NewLoginFailureRepository(db)
+	oidcIdentityRepo := repositories.NewOIDCIdentityRepository(db)
+	oidcStateRepo := repositories.NewOIDCLoginStateRepository(db)
 	messageRepo := repositories.NewMessageRepository(db)
 	roomRepo := repositories.NewRoomRepository(db)
+	roomMemberRepo := repositories.NewRoomMemberRepository(db)
+	roomReadRepo := repositories.NewRoomReadRepository(db)
+	attachmentRepo := repositories.NewAttachmentRepository(db)
+	uploadSessionRepo := repositories.NewUploadSessionRepository(db)
+	reactionRepo := repositories.NewReactionRepository(db)
+
+	signer, err := signing.NewFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWT signing keys: %w", err)
+	}
+
+	oidcConfigs, err := oidc.ConfigsFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OIDC providers: %w", err)
+	}
+
+	store, err := storage.NewFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	urlSigner, err := signing.NewURLSignerFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize URL signing: %w", err)
+	}
+
+	fileScanner, err := scanner.NewFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize scanner: %w", err)
+	}
+
+	box, err := secretbox.NewFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize secret encryption: %w", err)
+	}
 
 	// Initialize services
-	authService := services.NewAuthService(userRepo, tokenRepo)
 	userService := services.NewUserService(userRepo)
-	messageService := services.NewMessageService(messageRepo)
-	roomService := services.NewRoomService(roomRepo)
+	messageService := services.NewMessageService(messageRepo, roomMemberRepo, roomReadRepo, attachmentRepo, reactionRepo)
+	roomService := services.NewRoomService(roomRepo, roomMemberRepo, userRepo)
+	attachmentService := services.NewAttachmentService(attachmentRepo, messageRepo, roomMemberRepo, store, urlSigner)
 
 	// Initialize WebSocket hub
-	hub := websocket.NewHub()
+	hub := websocket.NewHub(roomService, userService)
+
+	// Revoking a token closes the sockets opened with it, and processed uploads
+	// are announced over them, so these depend on the hub
+	revocationService := services.NewTokenRevocationService(tokenRepo, hub)
+	mail, err := mailer.NewFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize mailer: %w", err)
+	}
+	limitStore := ratelimit.NewMemoryStore()
+	mailThrottle := services.NewMailThrottle(limitStore)
+	verificationService := services.NewEmailVerificationService(userRepo, emailVerificationRepo, mail, mailThrottle, services.EmailVerificationPolicyFromEnv())
+	twoFactorService := services.NewTwoFactorService(userRepo, recoveryCodeRepo, twoFactorChallengeRepo, box)
+	loginGuard := services.NewLoginGuard(limitStore, loginFailureRepo)
+	authService := services.NewAuthService(userRepo, tokenRepo, refreshTokenRepo, sessionRepo, revocationService, verificationService, twoFactorService, loginGuard, signer)
+	oidcService := services.NewOIDCService(oidcConfigs, userRepo, oidcIdentityRepo, oidcStateRepo, authService)
+	passwordService := services.NewPasswordService(userRepo, passwordResetRepo, authService, mail, mailThrottle)
+	mediaProcessor := services.NewMediaProcessor(attachmentRepo, messageRepo, store, fileScanner, hub)
+	uploadService := services.NewUploadService(attachmentRepo, uploadSessionRepo, store, mediaProcessor, services.UploadLimitsFromEnv(), services.UploadStagingDirFromEnv())
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService)
+	passwordHandler := handlers.NewPasswordHandler(passwordService)
+	verifyHandler := handlers.NewEmailVerificationHandler(verificationService)
+	twoFactorHandler := handlers.NewTwoFactorHandler(twoFactorService)
+	oidcHandler := handlers.NewOIDCHandler(oidcService)
+	jwksHandler := handlers.NewJWKSHandler(signer)
 	userHandler := handlers.NewUserHandler(userService)
 	wsHandler := handlers.NewWebSocketHandler(hub, messageService)
-	roomHandler := handlers.NewRoomHandler(roomService)
+	roomHandler := handlers.NewRoomHandler(roomService, hub)
+	messageHandler := handlers.NewMessageHandler(messageService, hub)
+	uploadHandler := handlers.NewUploadHandler(uploadService)
+	attachmentHandler := handlers.NewAttachmentHandler(attachmentService)
 
 	// Group handlers
 	allHandlers := &routes.Handlers{
-		AuthHandler:      authHandler,
-		UserHandler:      userHandler,
-		WebSocketHandler: wsHandler,
-		RoomHandler:      roomHandler,
+		AuthHandler:       authHandler,
+		PasswordHandler:   passwordHandler,
+		VerifyHandler:     verifyHandler,
+		TwoFactorHandler:  twoFactorHandler,
+		OIDCHandler:       oidcHandler,
+		JWKSHandler:       jwksHandler,
+		UserHandler:       userHandler,
+		WebSocketHandler:  wsHandler,
+		RoomHandler:       roomHandler,
+		MessageHandler:    messageHandler,
+		UploadHandler:     uploadHandler,
+		AttachmentHandler: attachmentHandler,
 	}
 
-	return &Container{
-		Handlers: allHandlers,
-		Hub:      hub,
+	authenticate := middleware.Authenticate(signer.Keyfunc, revocationService)
+	allMiddlewares := &routes.Middlewares{
+		Authenticate:             authenticate,
+		AuthenticateUnlessSigned: middleware.UnlessSigned(authenticate),
+		RequireVerifiedEmail:     middleware.RequireVerifiedEmail(verificationService),
 	}
+
+	return &Container{
+		Handlers:       allHandlers,
+		Middlewares:    allMiddlewares,
+		Hub:            hub,
+		MediaProcessor: mediaProcessor,
+		UploadService:  uploadService,
+	}, nil
 }
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"github.com/kevinsofyan/echoes-chat-api/internal/services"
+	"github.com/kevinsofyan/echoes-chat-api/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type AttachmentHandler struct {
+	attachmentService services.AttachmentService
+}
+
+func NewAttachmentHandler(attachmentService services.AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{
+		attachmentService: attachmentService,
+	}
+}
+
+// Download godoc
+// @Summary Download an attachment
+// @Description Requires a bearer token of a room member, or a signed link from /attachments/{id}/url. Supports Range requests for seeking.
+// @Tags attachments
+// @Security BearerAuth
+// @Produce octet-stream
+// @Param id path string true "Attachment UUID"
+// @Param expires query int false "Signed link expiry, as a Unix timestamp"
+// @Param sig query string false "Signed link signature"
+// @Param Range header string false "Byte range, e.g. bytes=0-1023"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 416 {object} map[string]interface{}
+// @Router /api/v1/attachments/{id} [get]
+func (h *AttachmentHandler) Download(c echo.Context) error {
+	return h.serve(c, false)
+}
+
+// DownloadThumbnail godoc
+// @Summary Download an attachment's thumbnail
+// @Description Images get a thumbnail once processed, listed with its size on the attachment. Access works as for the file itself.
+// @Tags attachments
+// @Security BearerAuth
+// @Produce image/jpeg,image/png
+// @Param id path string true "Attachment UUID"
+// @Param expires query int false "Signed link expiry, as a Unix timestamp"
+// @Param sig query string false "Signed link signature"
+// @Success 200 {file} file
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/attachments/{id}/thumbnail [get]
+func (h *AttachmentHandler) DownloadThumbnail(c echo.Context) error {
+	return h.serve(c, true)
+}
+
+// serve writes the attachment, or its thumbnail, after checking the signed
+// link or the user's access
+func (h *AttachmentHandler) serve(c echo.Context, thumbnail bool) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid attachment ID",
+		})
+	}
+
+	ctx := c.Request().Context()
+	var attachment *models.Attachment
+	var cacheControl string
+
+	if signature := c.QueryParam("sig"); signature != "" {
+		expiresUnix, err := strconv.ParseInt(c.QueryParam("expires"), 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusForbidden, map[string]interface{}{
+				"error": services.ErrInvalidSignedURL.Error(),
+			})
+		}
+
+		expires := time.Unix(expiresUnix, 0)
+		if attachment, err = h.attachmentService.GetSignedAttachment(ctx, id, thumbnail, expires, signature); err != nil {
+			return c.JSON(attachmentErrorStatus(err), map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+
+		// Shared caches such as a CDN may keep the response until the link expires
+		cacheControl = fmt.Sprintf("public, max-age=%d", int(time.Until(expires).Seconds()))
+	} else {
+		userID, err := utils.GetUserIDFromContext(c)
+		if err != nil {
+			return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+				"error": "Unauthorized",
+			})
+		}
+
+		if attachment, err = h.attachmentService.GetAttachment(ctx, id, userID); err != nil {
+			return c.JSON(attachmentErrorStatus(err), map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+
+		cacheControl = "private, no-cache"
+	}
+
+	header := c.Response().Header()
+	var content io.ReadSeeker
+	if thumbnail {
+		if content, err = h.attachmentService.OpenThumbnail(ctx, attachment); err != nil {
+			return c.JSON(attachmentErrorStatus(err), map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+
+		header.Set(echo.HeaderContentType, attachment.ThumbnailContentType)
+		header.Set(echo.HeaderContentDisposition, "inline")
+		header.Set("ETag", `"`+attachment.ThumbnailKey+`"`)
+	} else {
+		file := h.attachmentService.Open(ctx, attachment)
+		defer file.Close()
+		content = file
+
+		header.Set(echo.HeaderContentType, attachment.ContentType)
+		header.Set(echo.HeaderContentDisposition, contentDisposition(attachment))
+		// Content under a storage key never changes, so the key identifies it
+		header.Set("ETag", `"`+attachment.StorageKey+`"`)
+	}
+
+	header.Set("Cache-Control", cacheControl)
+	// Uploaded files must never run as a page on this origin
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+	header.Set(echo.HeaderContentSecurityPolicy, "default-src 'none'; sandbox")
+
+	// ServeContent answers Range, If-Range and conditional requests
+	http.ServeContent(c.Response(), c.Request(), attachment.Filename, attachment.UpdatedAt, content)
+	return nil
+}
+
+// GetSignedURL godoc
+// @Summary Create a signed download link
+// @Description Returns short-lived links to the attachment and its thumbnail that work without an Authorization header
+// @Tags attachments
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Attachment UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/attachments/{id}/url [get]
+func (h *AttachmentHandler) GetSignedURL(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid attachment ID",
+		})
+	}
+
+	signed, err := h.attachmentService.SignURL(c.Request().Context(), id, userID)
+	if err != nil {
+		return c.JSON(attachmentErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": signed,
+	})
+}
+
+// contentDisposition shows media inline and downloads anything else
+func contentDisposition(attachment *models.Attachment) string {
+	disposition := "attachment"
+	if attachment.Kind() != models.MessageTypeFile {
+		disposition = "inline"
+	}
+	return mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename})
+}
+
+func attachmentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrAttachmentNotFound), errors.Is(err, services.ErrThumbnailNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidSignedURL), errors.Is(err, services.ErrAttachmentQuarantined):
+		return http.StatusForbidden
+	default:
+		return roomErrorStatus(err)
+	}
+}
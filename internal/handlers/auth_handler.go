@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/kevinsofyan/echoes-chat-api/internal/services"
+	"github.com/kevinsofyan/echoes-chat-api/internal/utils"
 	"github.com/labstack/echo/v4"
 )
 
@@ -56,6 +61,8 @@ func (h *AuthHandler) Register(c echo.Context) error {
 // @Param request body services.LoginRequest true "Login Request"
 // @Success 200 {object} map[string]interface{}
 // @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
 // @Router /api/v1/auth/login [post]
 func (h *AuthHandler) Login(c echo.Context) error {
 	var req services.LoginRequest
@@ -65,53 +72,264 @@ func (h *AuthHandler) Login(c echo.Context) error {
 		})
 	}
 
-	user, token, err := h.authService.Login(c.Request().Context(), req)
+	result, err := h.authService.Login(c.Request().Context(), req, sessionMetadata(c))
 	if err != nil {
+		var locked *services.LoginLockedError
+		if errors.As(err, &locked) {
+			return tooManyAttempts(c, locked, locked.RetryAfter)
+		}
+		if errors.Is(err, services.ErrEmailNotVerified) {
+			return c.JSON(http.StatusForbidden, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
 		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
 			"error": err.Error(),
 		})
 	}
 
+	return loginResponse(c, result)
+}
+
+// VerifyTwoFactor godoc
+// @Summary Complete a login with a two-factor code
+// @Description Exchanges the challenge token from login and a TOTP or recovery code for a token pair
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body services.VerifyTwoFactorRequest true "Verify Two-Factor Request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Router /api/v1/auth/2fa/verify [post]
+func (h *AuthHandler) VerifyTwoFactor(c echo.Context) error {
+	var req services.VerifyTwoFactorRequest
+	if err := c.Bind(&req); err != nil || req.ChallengeToken == "" || req.Code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request body",
+		})
+	}
+
+	result, err := h.authService.VerifyTwoFactor(c.Request().Context(), req, sessionMetadata(c))
+	if err != nil {
+		var locked *services.LoginLockedError
+		if errors.As(err, &locked) {
+			return tooManyAttempts(c, locked, locked.RetryAfter)
+		}
+		if errors.Is(err, services.ErrInvalidChallenge) || errors.Is(err, services.ErrInvalidTwoFactorCode) {
+			return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to verify two-factor code",
+		})
+	}
+
+	return loginResponse(c, result)
+}
+
+// Refresh godoc
+// @Summary Exchange a refresh token for a new token pair
+// @Description The refresh token is single-use. Replaying one that was already exchanged revokes every token issued from the same login.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body services.RefreshRequest true "Refresh Request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /api/v1/auth/refresh [post]
+func (h *AuthHandler) Refresh(c echo.Context) error {
+	var req services.RefreshRequest
+	if err := c.Bind(&req); err != nil || req.RefreshToken == "" {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request body",
+		})
+	}
+
+	tokens, err := h.authService.Refresh(c.Request().Context(), req, sessionMetadata(c))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+			return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to refresh token",
+		})
+	}
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"message": "Login successful",
-		"data": map[string]interface{}{
-			"user":  user,
-			"token": token,
-		},
+		"message": "Token refreshed successfully",
+		"data":    tokens,
 	})
 }
 
 // Logout godoc
-// @Summary Logout user
+// @Summary Logout the current session
+// @Description Other devices stay signed in; use DELETE /auth/sessions to sign them out
 // @Tags auth
 // @Security BearerAuth
 // @Produce json
 // @Success 200 {object} map[string]interface{}
 // @Router /api/v1/auth/logout [post]
 func (h *AuthHandler) Logout(c echo.Context) error {
-	authHeader := c.Request().Header.Get("Authorization")
-	if authHeader == "" {
+	userID, sessionID, err := sessionFromContext(c)
+	if err != nil {
 		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
-			"error": "Missing authorization header",
+			"error": err.Error(),
 		})
 	}
 
-	parts := strings.Split(authHeader, " ")
-	if len(parts) != 2 || parts[0] != "Bearer" {
+	if err := h.authService.Logout(c.Request().Context(), userID, sessionID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Logged out successfully",
+	})
+}
+
+// GetSessions godoc
+// @Summary List the devices signed in to the current user's account
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/auth/sessions [get]
+func (h *AuthHandler) GetSessions(c echo.Context) error {
+	userID, sessionID, err := sessionFromContext(c)
+	if err != nil {
 		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
-			"error": "Invalid authorization header format",
+			"error": err.Error(),
 		})
 	}
 
-	token := parts[1]
+	sessions, err := h.authService.GetSessions(c.Request().Context(), userID, sessionID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to get sessions",
+		})
+	}
 
-	if err := h.authService.Logout(c.Request().Context(), token); err != nil {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": sessions,
+	})
+}
+
+// RevokeSession godoc
+// @Summary Sign out one device
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/auth/sessions/{id} [delete]
+func (h *AuthHandler) RevokeSession(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid session ID",
+		})
+	}
+
+	if err := h.authService.RevokeSession(c.Request().Context(), userID, sessionID); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to revoke session",
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Session revoked successfully",
+	})
+}
+
+// RevokeOtherSessions godoc
+// @Summary Sign out all other devices
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/auth/sessions [delete]
+func (h *AuthHandler) RevokeOtherSessions(c echo.Context) error {
+	userID, sessionID, err := sessionFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
 			"error": err.Error(),
 		})
 	}
 
+	if err := h.authService.RevokeOtherSessions(c.Request().Context(), userID, sessionID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to revoke sessions",
+		})
+	}
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"message": "Logged out successfully",
+		"message": "Signed out of all other devices",
 	})
 }
+
+func tooManyAttempts(c echo.Context, err error, wait time.Duration) error {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	return c.JSON(http.StatusTooManyRequests, map[string]interface{}{
+		"error":       err.Error(),
+		"retry_after": retryAfter,
+	})
+}
+
+// loginResponse returns the token pair, or the challenge when a second factor is still needed
+func loginResponse(c echo.Context, result *services.LoginResult) error {
+	if result.Challenge != nil {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"message": "Two-factor authentication required",
+			"data": map[string]interface{}{
+				"two_factor_required": true,
+				"challenge_token":     result.Challenge.Token,
+				"expires_in":          result.Challenge.ExpiresIn,
+			},
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Login successful",
+		"data": map[string]interface{}{
+			"user":          result.User,
+			"token":         result.Tokens.AccessToken,
+			"refresh_token": result.Tokens.RefreshToken,
+			"expires_in":    result.Tokens.ExpiresIn,
+		},
+	})
+}
+
+func sessionMetadata(c echo.Context) services.SessionMetadata {
+	return services.SessionMetadata{
+		UserAgent: c.Request().UserAgent(),
+		IPAddress: c.RealIP(),
+	}
+}
+
+func sessionFromContext(c echo.Context) (uuid.UUID, uuid.UUID, error) {
+	principal, err := utils.GetPrincipal(c)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	return principal.UserID, principal.SessionID, nil
+}
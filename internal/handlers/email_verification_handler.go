@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/kevinsofyan/echoes-chat-api/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+type EmailVerificationHandler struct {
+	verificationService services.EmailVerificationService
+}
+
+func NewEmailVerificationHandler(verificationService services.EmailVerificationService) *EmailVerificationHandler {
+	return &EmailVerificationHandler{
+		verificationService: verificationService,
+	}
+}
+
+// VerifyEmail godoc
+// @Summary Verify an email address with the emailed token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body services.VerifyEmailRequest true "Verify Email Request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/auth/verify-email [post]
+func (h *EmailVerificationHandler) VerifyEmail(c echo.Context) error {
+	var req services.VerifyEmailRequest
+	if err := c.Bind(&req); err != nil || req.Token == "" {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.verificationService.VerifyEmail(c.Request().Context(), req); err != nil {
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			return c.JSON(http.StatusBadRequest, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to verify email",
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Email verified successfully",
+	})
+}
+
+// ResendVerification godoc
+// @Summary Send another verification email
+// @Description Responds the same way whether or not the email has an unverified account
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body services.ResendVerificationRequest true "Resend Verification Request"
+// @Success 202 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Router /api/v1/auth/verify-email/resend [post]
+func (h *EmailVerificationHandler) ResendVerification(c echo.Context) error {
+	var req services.ResendVerificationRequest
+	if err := c.Bind(&req); err != nil || req.Email == "" {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.verificationService.ResendVerification(c.Request().Context(), req, c.RealIP()); err != nil {
+		var limited *services.MailRequestLimitedError
+		if errors.As(err, &limited) {
+			return tooManyAttempts(c, limited, limited.RetryAfter)
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to send verification email",
+		})
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
+		"message": "If the email has an unverified account, a verification link has been sent",
+	})
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/kevinsofyan/echoes-chat-api/internal/signing"
+	"github.com/labstack/echo/v4"
+)
+
+type JWKSHandler struct {
+	signer signing.Signer
+}
+
+func NewJWKSHandler(signer signing.Signer) *JWKSHandler {
+	return &JWKSHandler{
+		signer: signer,
+	}
+}
+
+// GetJWKS godoc
+// @Summary Public keys for verifying access tokens
+// @Description JSON Web Key Set of the keys tokens are signed with, selected by the kid header. Empty when tokens use a shared secret.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} signing.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *JWKSHandler) GetJWKS(c echo.Context) error {
+	// Short enough that verifiers pick up a new key soon after rotation
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, h.signer.JWKS())
+}
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/services"
+	"github.com/kevinsofyan/echoes-chat-api/internal/utils"
+	ws "github.com/kevinsofyan/echoes-chat-api/internal/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+type MessageHandler struct {
+	messageService services.MessageService
+	hub            *ws.Hub
+}
+
+func NewMessageHandler(messageService services.MessageService, hub *ws.Hub) *MessageHandler {
+	return &MessageHandler{
+		messageService: messageService,
+		hub:            hub,
+	}
+}
+
+// GetRoomMessages godoc
+// @Summary Get message history for a room
+// @Tags messages
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Room UUID"
+// @Param before query string false "Cursor to page towards older messages"
+// @Param after query string false "Cursor to page towards newer messages"
+// @Param around query string false "Cursor to center the page on"
+// @Param limit query int false "Limit" default(50)
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /api/v1/rooms/{id}/messages [get]
+func (h *MessageHandler) GetRoomMessages(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid room ID",
+		})
+	}
+
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	req := services.MessagePageRequest{
+		Before: c.QueryParam("before"),
+		After:  c.QueryParam("after"),
+		Around: c.QueryParam("around"),
+		Limit:  limit,
+	}
+
+	page, err := h.messageService.GetMessagesByRoomID(c.Request().Context(), roomID, userID, req)
+	if err != nil {
+		return c.JSON(messageErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": page,
+	})
+}
+
+// GetMessageByID godoc
+// @Summary Get a message by ID
+// @Tags messages
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Message UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/messages/{id} [get]
+func (h *MessageHandler) GetMessageByID(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid message ID",
+		})
+	}
+
+	message, err := h.messageService.GetMessageByID(c.Request().Context(), id, userID)
+	if err != nil {
+		return c.JSON(messageErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	// The cursor lets clients jump to this message with ?around=
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":   message,
+		"cursor": services.EncodeMessageCursor(message),
+	})
+}
+
+// UpdateMessage godoc
+// @Summary Edit a message (sender only)
+// @Tags messages
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Message UUID"
+// @Param request body services.UpdateMessageRequest true "Update Request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/messages/{id} [patch]
+func (h *MessageHandler) UpdateMessage(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid message ID",
+		})
+	}
+
+	var req services.UpdateMessageRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request body",
+		})
+	}
+
+	message, err := h.messageService.UpdateMessage(c.Request().Context(), id, userID, req)
+	if err != nil {
+		return c.JSON(messageErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	h.hub.BroadcastToRoom(message.RoomID, ws.NewMessageUpdatedEvent(message))
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Message updated successfully",
+		"data":    message,
+	})
+}
+
+// DeleteMessage godoc
+// @Summary Delete a message (sender or room admin)
+// @Tags messages
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Message UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/messages/{id} [delete]
+func (h *MessageHandler) DeleteMessage(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid message ID",
+		})
+	}
+
+	message, err := h.messageService.DeleteMessage(c.Request().Context(), id, userID)
+	if err != nil {
+		return c.JSON(messageErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	h.hub.BroadcastToRoom(message.RoomID, ws.NewMessageDeletedEvent(message))
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Message deleted successfully",
+	})
+}
+
+// MarkRoomRead godoc
+// @Summary Mark a room as read up to a message
+// @Tags messages
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Room UUID"
+// @Param request body services.MarkReadRequest true "Last read message"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/rooms/{id}/read [post]
+func (h *MessageHandler) MarkRoomRead(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid room ID",
+		})
+	}
+
+	var req services.MarkReadRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request body",
+		})
+	}
+
+	read, err := h.messageService.MarkAsRead(c.Request().Context(), roomID, userID, req)
+	if err != nil {
+		return c.JSON(messageErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	h.hub.BroadcastToRoom(roomID, ws.NewReadReceiptEvent(read))
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": read,
+	})
+}
+
+// AddReaction godoc
+// @Summary React to a message with an emoji
+// @Tags messages
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Message UUID"
+// @Param request body services.ReactionRequest true "Emoji to react with"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/messages/{id}/reactions [post]
+func (h *MessageHandler) AddReaction(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid message ID",
+		})
+	}
+
+	var req services.ReactionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request body",
+		})
+	}
+
+	change, err := h.messageService.AddReaction(c.Request().Context(), id, userID, req)
+	if err != nil {
+		return c.JSON(messageErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	event := ws.NewReactionAddedEvent(change)
+	if change.Changed {
+		h.hub.Broadcast <- event
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Reaction added successfully",
+		"data":    event.Payload,
+	})
+}
+
+// RemoveReaction godoc
+// @Summary Remove your reaction to a message
+// @Tags messages
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Message UUID"
+// @Param emoji path string true "URL-encoded emoji"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/messages/{id}/reactions/{emoji} [delete]
+func (h *MessageHandler) RemoveReaction(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid message ID",
+		})
+	}
+
+	// Echo leaves the parameter escaped when the path had to be kept raw
+	emoji, err := url.PathUnescape(c.Param("emoji"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid emoji",
+		})
+	}
+
+	change, err := h.messageService.RemoveReaction(c.Request().Context(), id, userID, services.ReactionRequest{
+		Emoji: emoji,
+	})
+	if err != nil {
+		return c.JSON(messageErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	event := ws.NewReactionRemovedEvent(change)
+	h.hub.Broadcast <- event
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Reaction removed successfully",
+		"data":    event.Payload,
+	})
+}
+
+// messageErrorStatus maps message service errors to HTTP status codes
+func messageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrMessageNotFound),
+		errors.Is(err, services.ErrReactionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidReaction),
+		errors.Is(err, services.ErrTooManyReactions),
+		errors.Is(err, services.ErrContentRequired),
+		errors.Is(err, services.ErrInvalidMessageType),
+		errors.Is(err, services.ErrInvalidCursor),
+		errors.Is(err, services.ErrConflictingCursor):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrNotMessageSender):
+		return http.StatusForbidden
+	default:
+		return roomErrorStatus(err)
+	}
+}
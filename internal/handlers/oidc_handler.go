@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/kevinsofyan/echoes-chat-api/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+// oidcStateCookie ties the callback to the browser that started the login,
+// so a victim can't be signed in to an attacker's account with a forged callback
+const oidcStateCookie = "oidc_state"
+
+type OIDCHandler struct {
+	oidcService services.OIDCService
+}
+
+func NewOIDCHandler(oidcService services.OIDCService) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: oidcService,
+	}
+}
+
+// GetProviders godoc
+// @Summary List single sign-on providers
+// @Tags auth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/auth/oidc/providers [get]
+func (h *OIDCHandler) GetProviders(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Providers retrieved successfully",
+		"data":    h.oidcService.Providers(),
+	})
+}
+
+// Login godoc
+// @Summary Sign in with a single sign-on provider
+// @Description Redirects to the provider to sign in. The provider redirects back to the callback.
+// @Tags auth
+// @Param provider path string true "Provider name"
+// @Success 302
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/auth/oidc/{provider}/login [get]
+func (h *OIDCHandler) Login(c echo.Context) error {
+	provider := c.Param("provider")
+
+	login, err := h.oidcService.BeginLogin(c.Request().Context(), provider)
+	if err != nil {
+		return c.JSON(oidcErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    login.State,
+		Path:     oidcCookiePath(provider),
+		MaxAge:   int(login.ExpiresIn),
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		// Lax so the cookie is sent on the provider's top-level redirect back
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return c.Redirect(http.StatusFound, login.AuthURL)
+}
+
+// Callback godoc
+// @Summary Complete a single sign-on login
+// @Description Exchanges the authorization code for a token pair, or a two-factor challenge. The account is linked by verified email, or created.
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param code query string true "Authorization code"
+// @Param state query string true "Login state"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /api/v1/auth/oidc/{provider}/callback [get]
+func (h *OIDCHandler) Callback(c echo.Context) error {
+	provider := c.Param("provider")
+
+	// Expire the state cookie whatever the outcome; it is single-use
+	c.SetCookie(&http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     oidcCookiePath(provider),
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	// The user declined, or the provider rejected the request
+	if providerError := c.QueryParam("error"); providerError != "" {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error":       services.ErrOIDCLoginFailed.Error(),
+			"reason":      providerError,
+			"description": c.QueryParam("error_description"),
+		})
+	}
+
+	var req services.OIDCCallbackRequest
+	if err := c.Bind(&req); err != nil || req.State == "" || req.Code == "" {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Missing code or state",
+		})
+	}
+
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(req.State)) != 1 {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": services.ErrInvalidOIDCState.Error(),
+		})
+	}
+
+	result, err := h.oidcService.CompleteLogin(c.Request().Context(), provider, req, sessionMetadata(c))
+	if err != nil {
+		return c.JSON(oidcErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return loginResponse(c, result)
+}
+
+func oidcCookiePath(provider string) string {
+	return "/api/v1/auth/oidc/" + provider
+}
+
+func oidcErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUnknownOIDCProvider):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidOIDCState):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrOIDCEmailNotVerified),
+		errors.Is(err, services.ErrOIDCAccountLinked),
+		errors.Is(err, services.ErrOIDCAccountUnverified):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrOIDCLoginFailed):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/kevinsofyan/echoes-chat-api/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+type PasswordHandler struct {
+	passwordService services.PasswordService
+}
+
+func NewPasswordHandler(passwordService services.PasswordService) *PasswordHandler {
+	return &PasswordHandler{
+		passwordService: passwordService,
+	}
+}
+
+// ChangePassword godoc
+// @Summary Change the current user's password
+// @Description Requires the current password. Every other session is signed out.
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body services.ChangePasswordRequest true "Change Password Request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/auth/password/change [post]
+func (h *PasswordHandler) ChangePassword(c echo.Context) error {
+	userID, sessionID, err := sessionFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	var req services.ChangePasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.passwordService.ChangePassword(c.Request().Context(), userID, sessionID, req); err != nil {
+		return c.JSON(passwordErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Password changed successfully",
+	})
+}
+
+// ForgotPassword godoc
+// @Summary Email a password reset link
+// @Description Responds the same way whether or not the email has an account
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body services.ForgotPasswordRequest true "Forgot Password Request"
+// @Success 202 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Router /api/v1/auth/password/forgot [post]
+func (h *PasswordHandler) ForgotPassword(c echo.Context) error {
+	var req services.ForgotPasswordRequest
+	if err := c.Bind(&req); err != nil || req.Email == "" {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.passwordService.ForgotPassword(c.Request().Context(), req, c.RealIP()); err != nil {
+		var limited *services.MailRequestLimitedError
+		if errors.As(err, &limited) {
+			return tooManyAttempts(c, limited, limited.RetryAfter)
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": "Failed to send reset email",
+		})
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
+		"message": "If the email has an account, a reset link has been sent",
+	})
+}
+
+// ResetPassword godoc
+// @Summary Set a new password with a reset token
+// @Description Every session is signed out
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body services.ResetPasswordRequest true "Reset Password Request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/auth/password/reset [post]
+func (h *PasswordHandler) ResetPassword(c echo.Context) error {
+	var req services.ResetPasswordRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.passwordService.ResetPassword(c.Request().Context(), req); err != nil {
+		return c.JSON(passwordErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Password reset successfully",
+	})
+}
+
+func passwordErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrIncorrectPassword),
+		errors.Is(err, services.ErrWeakPassword),
+		errors.Is(err, services.ErrInvalidResetToken):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
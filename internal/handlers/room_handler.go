@@ -1,21 +1,26 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 
 	"github.com/google/uuid"
 	"github.com/kevinsofyan/echoes-chat-api/internal/services"
 	"github.com/kevinsofyan/echoes-chat-api/internal/utils"
+	ws "github.com/kevinsofyan/echoes-chat-api/internal/websocket"
 	"github.com/labstack/echo/v4"
 )
 
 type RoomHandler struct {
 	roomService services.RoomService
+	hub         *ws.Hub
 }
 
-func NewRoomHandler(roomService services.RoomService) *RoomHandler {
+func NewRoomHandler(roomService services.RoomService, hub *ws.Hub) *RoomHandler {
 	return &RoomHandler{
 		roomService: roomService,
+		hub:         hub,
 	}
 }
 
@@ -29,6 +34,7 @@ func NewRoomHandler(roomService services.RoomService) *RoomHandler {
 // @Success 201 {object} map[string]interface{}
 // @Failure 400 {object} map[string]interface{}
 // @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
 // @Router /api/v1/rooms [post]
 func (h *RoomHandler) CreateRoom(c echo.Context) error {
 	userID, err := utils.GetUserIDFromContext(c)
@@ -49,9 +55,11 @@ func (h *RoomHandler) CreateRoom(c echo.Context) error {
 
 	room, err := h.roomService.CreateRoom(c.Request().Context(), req)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]interface{}{
-			"error": err.Error(),
-		})
+		return roomError(c, err)
+	}
+
+	for _, member := range room.Members {
+		h.hub.AddRoomMember(room.ID, member.UserID)
 	}
 
 	return c.JSON(http.StatusCreated, map[string]interface{}{
@@ -67,9 +75,17 @@ func (h *RoomHandler) CreateRoom(c echo.Context) error {
 // @Produce json
 // @Param id path string true "Room UUID"
 // @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
 // @Router /api/v1/rooms/{id} [get]
 func (h *RoomHandler) GetRoomByID(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]interface{}{
@@ -77,11 +93,9 @@ func (h *RoomHandler) GetRoomByID(c echo.Context) error {
 		})
 	}
 
-	room, err := h.roomService.GetRoomByID(c.Request().Context(), id)
+	room, err := h.roomService.GetRoomByID(c.Request().Context(), id, userID)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]interface{}{
-			"error": "Room not found",
-		})
+		return roomError(c, err)
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
@@ -90,7 +104,7 @@ func (h *RoomHandler) GetRoomByID(c echo.Context) error {
 }
 
 // GetMyRooms godoc
-// @Summary Get rooms for authenticated user
+// @Summary Get rooms for authenticated user with unread counts and last message
 // @Tags rooms
 // @Security BearerAuth
 // @Produce json
@@ -107,12 +121,310 @@ func (h *RoomHandler) GetMyRooms(c echo.Context) error {
 
 	rooms, err := h.roomService.GetUserRooms(c.Request().Context(), userID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": err.Error(),
-		})
+		return roomError(c, err)
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"data": rooms,
 	})
 }
+
+// GetMembers godoc
+// @Summary List members of a room
+// @Tags rooms
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Room UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/rooms/{id}/members [get]
+func (h *RoomHandler) GetMembers(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid room ID",
+		})
+	}
+
+	members, err := h.roomService.GetMembers(c.Request().Context(), roomID, userID)
+	if err != nil {
+		return roomError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": members,
+	})
+}
+
+// AddMember godoc
+// @Summary Invite a user to a room (admins and owner only)
+// @Tags rooms
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Room UUID"
+// @Param request body services.AddMemberRequest true "Member to add"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/rooms/{id}/members [post]
+func (h *RoomHandler) AddMember(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid room ID",
+		})
+	}
+
+	var req services.AddMemberRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request body",
+		})
+	}
+
+	member, err := h.roomService.AddMember(c.Request().Context(), roomID, userID, req)
+	if err != nil {
+		return roomError(c, err)
+	}
+
+	h.hub.AddRoomMember(roomID, member.UserID)
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message": "Member added successfully",
+		"data":    member,
+	})
+}
+
+// RemoveMember godoc
+// @Summary Remove a member from a room (admins and owner only)
+// @Tags rooms
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Room UUID"
+// @Param userId path string true "User UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/rooms/{id}/members/{userId} [delete]
+func (h *RoomHandler) RemoveMember(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid room ID",
+		})
+	}
+
+	targetID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if err := h.roomService.RemoveMember(c.Request().Context(), roomID, userID, targetID); err != nil {
+		return roomError(c, err)
+	}
+
+	h.hub.RemoveRoomMember(roomID, targetID)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Member removed successfully",
+	})
+}
+
+// LeaveRoom godoc
+// @Summary Leave a room
+// @Tags rooms
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Room UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /api/v1/rooms/{id}/members/me [delete]
+func (h *RoomHandler) LeaveRoom(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid room ID",
+		})
+	}
+
+	if err := h.roomService.LeaveRoom(c.Request().Context(), roomID, userID); err != nil {
+		return roomError(c, err)
+	}
+
+	h.hub.RemoveRoomMember(roomID, userID)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Left room successfully",
+	})
+}
+
+// UpdateMemberRole godoc
+// @Summary Promote or demote a room member (owner only)
+// @Tags rooms
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Room UUID"
+// @Param userId path string true "User UUID"
+// @Param request body services.UpdateMemberRoleRequest true "New role"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/rooms/{id}/members/{userId} [patch]
+func (h *RoomHandler) UpdateMemberRole(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid room ID",
+		})
+	}
+
+	targetID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid user ID",
+		})
+	}
+
+	var req services.UpdateMemberRoleRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request body",
+		})
+	}
+
+	member, err := h.roomService.UpdateMemberRole(c.Request().Context(), roomID, userID, targetID, req)
+	if err != nil {
+		return roomError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Member role updated successfully",
+		"data":    member,
+	})
+}
+
+// TransferOwnership godoc
+// @Summary Transfer room ownership to another member (owner only)
+// @Tags rooms
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Room UUID"
+// @Param userId path string true "New owner UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/rooms/{id}/members/{userId}/transfer-ownership [post]
+func (h *RoomHandler) TransferOwnership(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	roomID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid room ID",
+		})
+	}
+
+	targetID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if err := h.roomService.TransferOwnership(c.Request().Context(), roomID, userID, targetID); err != nil {
+		return roomError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Ownership transferred successfully",
+	})
+}
+
+// roomError responds with the status for a room service error. Unexpected
+// errors are logged instead of returned, so database details stay internal.
+func roomError(c echo.Context, err error) error {
+	status := roomErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		log.Printf("room request %s %s failed: %v", c.Request().Method, c.Path(), err)
+		return c.JSON(status, map[string]interface{}{
+			"error": "Internal server error",
+		})
+	}
+	return c.JSON(status, map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+// roomErrorStatus maps room service errors to HTTP status codes
+func roomErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrRoomNotFound),
+		errors.Is(err, services.ErrMemberNotFound),
+		errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrNotRoomMember), errors.Is(err, services.ErrInsufficientRole):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrAlreadyRoomMember):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrOwnerCannotLeave),
+		errors.Is(err, services.ErrDirectRoomMembers),
+		errors.Is(err, services.ErrInvalidDirectRoom),
+		errors.Is(err, services.ErrInvalidRoomType),
+		errors.Is(err, services.ErrInvalidMemberRole),
+		errors.Is(err, services.ErrCannotTargetSelf),
+		errors.Is(err, services.ErrAlreadyRoomOwner),
+		errors.Is(err, services.ErrMemberUserRequired):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/kevinsofyan/echoes-chat-api/internal/services"
+	"github.com/kevinsofyan/echoes-chat-api/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type TwoFactorHandler struct {
+	twoFactorService services.TwoFactorService
+}
+
+func NewTwoFactorHandler(twoFactorService services.TwoFactorService) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		twoFactorService: twoFactorService,
+	}
+}
+
+// Setup godoc
+// @Summary Start two-factor enrollment
+// @Description Returns a TOTP secret and an otpauth:// URI to show as a QR code. Two-factor is not enabled until confirmed.
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/auth/2fa/setup [post]
+func (h *TwoFactorHandler) Setup(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	setup, err := h.twoFactorService.Setup(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(twoFactorErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": setup,
+	})
+}
+
+// Enable godoc
+// @Summary Confirm two-factor enrollment with a TOTP code
+// @Description Returns the recovery codes. They are only shown once.
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body services.TwoFactorCodeRequest true "Two-Factor Code"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/auth/2fa/enable [post]
+func (h *TwoFactorHandler) Enable(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	var req services.TwoFactorCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request body",
+		})
+	}
+
+	codes, err := h.twoFactorService.Enable(c.Request().Context(), userID, req)
+	if err != nil {
+		return c.JSON(twoFactorErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Two-factor authentication enabled",
+		"data": map[string]interface{}{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// Disable godoc
+// @Summary Turn off two-factor authentication
+// @Description Requires the password and a TOTP or recovery code
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body services.DisableTwoFactorRequest true "Disable Two-Factor Request"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/auth/2fa/disable [post]
+func (h *TwoFactorHandler) Disable(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	var req services.DisableTwoFactorRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.twoFactorService.Disable(c.Request().Context(), userID, req); err != nil {
+		return c.JSON(twoFactorErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Replace the recovery codes
+// @Description Requires a TOTP code. Previous recovery codes stop working.
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body services.TwoFactorCodeRequest true "Two-Factor Code"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /api/v1/auth/2fa/recovery-codes [post]
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	var req services.TwoFactorCodeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request body",
+		})
+	}
+
+	codes, err := h.twoFactorService.RegenerateRecoveryCodes(c.Request().Context(), userID, req)
+	if err != nil {
+		return c.JSON(twoFactorErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+func twoFactorErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTwoFactorAlreadyEnabled),
+		errors.Is(err, services.ErrTwoFactorNotEnabled):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrTwoFactorNotSetUp),
+		errors.Is(err, services.ErrInvalidTwoFactorCode),
+		errors.Is(err, services.ErrIncorrectPassword):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
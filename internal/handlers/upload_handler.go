@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/services"
+	"github.com/kevinsofyan/echoes-chat-api/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// multipartOverhead allows for the form's boundaries and headers around the file
+	multipartOverhead  = 1 << 20
+	maxChunkSize       = 16 << 20
+	uploadOffsetHeader = "Upload-Offset"
+)
+
+type UploadHandler struct {
+	uploadService services.UploadService
+}
+
+func NewUploadHandler(uploadService services.UploadService) *UploadHandler {
+	return &UploadHandler{
+		uploadService: uploadService,
+	}
+}
+
+// Upload godoc
+// @Summary Upload a file
+// @Description Uploads a file in one request. Send the returned attachment ID with a message. The type is sniffed from the content, and each type has its own size limit.
+// @Tags uploads
+// @Security BearerAuth
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "File"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 413 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Router /api/v1/uploads [post]
+func (h *UploadHandler) Upload(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, h.uploadService.Limits().Max()+multipartOverhead)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return c.JSON(http.StatusRequestEntityTooLarge, map[string]interface{}{
+				"error": services.ErrFileTooLarge.Error(),
+			})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "A file is required in the \"file\" field",
+		})
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Failed to read file",
+		})
+	}
+	defer file.Close()
+
+	attachment, err := h.uploadService.Upload(req.Context(), userID, fileHeader.Filename, file, fileHeader.Size)
+	if err != nil {
+		return c.JSON(uploadErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message": "File uploaded successfully",
+		"data":    attachment,
+	})
+}
+
+// StartUpload godoc
+// @Summary Start a resumable upload
+// @Description Creates an upload session for a file sent in chunks with PATCH /uploads/sessions/{id}
+// @Tags uploads
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body services.StartUploadRequest true "Start Upload Request"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 413 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Router /api/v1/uploads/sessions [post]
+func (h *UploadHandler) StartUpload(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req services.StartUploadRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid request body",
+		})
+	}
+
+	session, err := h.uploadService.StartUpload(c.Request().Context(), userID, req)
+	if err != nil {
+		return c.JSON(uploadErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message": "Upload started",
+		"data":    session,
+	})
+}
+
+// GetUpload godoc
+// @Summary Get a resumable upload
+// @Description Returns the session's offset, where an interrupted upload continues from
+// @Tags uploads
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Upload session UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /api/v1/uploads/sessions/{id} [get]
+func (h *UploadHandler) GetUpload(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid upload ID",
+		})
+	}
+
+	session, err := h.uploadService.GetUpload(c.Request().Context(), userID, sessionID)
+	if err != nil {
+		return c.JSON(uploadErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	c.Response().Header().Set(uploadOffsetHeader, strconv.FormatInt(session.Offset, 10))
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": session,
+	})
+}
+
+// UploadChunk godoc
+// @Summary Send the next chunk of a resumable upload
+// @Description The raw request body is written at the Upload-Offset header, which must match the session's offset. Once every byte has arrived the session's attachment_id is set.
+// @Tags uploads
+// @Security BearerAuth
+// @Accept application/octet-stream
+// @Produce json
+// @Param id path string true "Upload session UUID"
+// @Param Upload-Offset header int true "Byte offset of this chunk"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/v1/uploads/sessions/{id} [patch]
+func (h *UploadHandler) UploadChunk(c echo.Context) error {
+	userID, err := utils.GetUserIDFromContext(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Unauthorized",
+		})
+	}
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Invalid upload ID",
+		})
+	}
+
+	offset, err := strconv.ParseInt(c.Request().Header.Get(uploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "A valid Upload-Offset header is required",
+		})
+	}
+
+	body := http.MaxBytesReader(c.Response(), c.Request().Body, maxChunkSize)
+	session, err := h.uploadService.AppendChunk(c.Request().Context(), userID, sessionID, offset, body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return c.JSON(http.StatusRequestEntityTooLarge, map[string]interface{}{
+				"error":          "Chunk is too large",
+				"max_chunk_size": maxChunkSize,
+			})
+		}
+		return c.JSON(uploadErrorStatus(err), map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	c.Response().Header().Set(uploadOffsetHeader, strconv.FormatInt(session.Offset, 10))
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": session,
+	})
+}
+
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrFileTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrEmptyUpload),
+		errors.Is(err, services.ErrChunkOutOfRange):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrUploadNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrUploadOffsetMismatch):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrTooManyUploads),
+		errors.Is(err, services.ErrUploadQuotaExceeded):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
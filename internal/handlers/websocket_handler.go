@@ -38,8 +38,8 @@ func NewWebSocketHandler(hub *ws.Hub, messageService services.MessageService) *W
 // @Security BearerAuth
 // @Router /api/v1/ws/chat [get]
 func (h *WebSocketHandler) HandleWebSocket(c echo.Context) error {
-	// Get user ID from JWT token
-	userID, err := utils.GetUserIDFromContext(c)
+	// Get the caller from the verified access token
+	principal, err := utils.GetPrincipal(c)
 	if err != nil {
 		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
 			"error": "unauthorized",
@@ -53,7 +53,7 @@ func (h *WebSocketHandler) HandleWebSocket(c echo.Context) error {
 		return err
 	}
 
-	client := ws.NewClient(userID, conn, h.hub, h.messageService)
+	client := ws.NewClient(principal.UserID, principal.TokenID, principal.SessionID, conn, h.hub, h.messageService)
 
 	h.hub.Register <- client
 
@@ -0,0 +1,117 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email. The log and file mailers are meant for local
+// development; other providers can be plugged in through the container.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewFromEnv picks a mailer using MAILER ("smtp", "log" or "file"). The log and
+// file mailers write reset and verification links in the clear, so they are
+// only allowed when ENV is "development", where an unset MAILER falls back to
+// logging. The file mailer writes to MAILER_DIR.
+func NewFromEnv() (Mailer, error) {
+	name := os.Getenv("MAILER")
+	development := os.Getenv("ENV") == "development"
+
+	switch name {
+	case "smtp":
+		return NewSMTPMailerFromEnv()
+	case "", "log", "file":
+		if !development {
+			if name == "" {
+				return nil, errors.New("MAILER must be set outside development")
+			}
+			return nil, fmt.Errorf("MAILER %q is only allowed in development", name)
+		}
+		if name == "file" {
+			dir := os.Getenv("MAILER_DIR")
+			if dir == "" {
+				dir = "tmp/mail"
+			}
+			return NewFileMailer(dir), nil
+		}
+		return NewLogMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q", name)
+	}
+}
+
+type logMailer struct{}
+
+// NewLogMailer writes every message to the application log
+func NewLogMailer() Mailer {
+	return &logMailer{}
+}
+
+func (m *logMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+type fileMailer struct {
+	dir string
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewFileMailer writes each message to its own .eml file in dir
+func NewFileMailer(dir string) Mailer {
+	return &fileMailer{dir: dir}
+}
+
+func (m *fileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %w", err)
+	}
+
+	m.mu.Lock()
+	m.seq++
+	seq := m.seq
+	m.mu.Unlock()
+
+	name := fmt.Sprintf("%s-%04d-%s.eml", time.Now().UTC().Format("20060102T150405"), seq, sanitizeFilename(msg.To))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	if err := os.WriteFile(filepath.Join(m.dir, name), []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("failed to write mail: %w", err)
+	}
+	return nil
+}
+
+func sanitizeFilename(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
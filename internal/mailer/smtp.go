@@ -0,0 +1,72 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer sends through the SMTP server at addr. The connection is
+// upgraded with STARTTLS when the server offers it, and auth is only sent over
+// TLS unless the server is on localhost.
+func NewSMTPMailer(addr string, auth smtp.Auth, from string) Mailer {
+	return &smtpMailer{addr: addr, auth: auth, from: from}
+}
+
+// NewSMTPMailerFromEnv configures the SMTP mailer from SMTP_HOST, SMTP_PORT
+// (default 587), SMTP_USERNAME, SMTP_PASSWORD and MAILER_FROM
+func NewSMTPMailerFromEnv() (Mailer, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil, errors.New("SMTP_HOST must be set for the smtp mailer")
+	}
+	from := os.Getenv("MAILER_FROM")
+	if from == "" {
+		return nil, errors.New("MAILER_FROM must be set for the smtp mailer")
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	var auth smtp.Auth
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+
+	return NewSMTPMailer(net.JoinHostPort(host, port), auth, from), nil
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg Message) error {
+	// Headers are built from the message, so line breaks could inject new ones
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return errors.New("invalid mail header")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	// net/smtp has no context support, so the send runs to completion or failure
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, []byte(b.String())); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
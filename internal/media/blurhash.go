@@ -0,0 +1,108 @@
+package media
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Blurhash encodes a compact placeholder for an image (https://blurha.sh),
+// using four components along the longer side and three along the shorter
+func Blurhash(img *image.RGBA) string {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	xComponents, yComponents := 4, 3
+	if height > width {
+		xComponents, yComponents = 3, 4
+	}
+
+	// Convert once; each component revisits every pixel
+	linear := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := img.RGBAAt(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+			linear[y*width+x] = [3]float64{srgbToLinear(c.R), srgbToLinear(c.G), srgbToLinear(c.B)}
+		}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := normalisation *
+						math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+					pixel := linear[y*width+x]
+					factor[0] += basis * pixel[0]
+					factor[1] += basis * pixel[1]
+					factor[2] += basis * pixel[2]
+				}
+			}
+
+			scale := 1 / float64(width*height)
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+
+	var hash strings.Builder
+	writeBase83(&hash, (xComponents-1)+(yComponents-1)*9, 1)
+
+	dc, ac := factors[0], factors[1:]
+	maximumValue := 1.0
+	if len(ac) > 0 {
+		actualMaximum := 0.0
+		for _, factor := range ac {
+			actualMaximum = max(actualMaximum, math.Abs(factor[0]), math.Abs(factor[1]), math.Abs(factor[2]))
+		}
+		quantisedMaximum := int(max(0, min(82, math.Floor(actualMaximum*166-0.5))))
+		maximumValue = float64(quantisedMaximum+1) / 166
+		writeBase83(&hash, quantisedMaximum, 1)
+	} else {
+		writeBase83(&hash, 0, 1)
+	}
+
+	writeBase83(&hash, linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4)
+	for _, factor := range ac {
+		quantise := func(value float64) int {
+			return int(max(0, min(18, math.Floor(signPow(value/maximumValue, 0.5)*9+9.5))))
+		}
+		writeBase83(&hash, quantise(factor[0])*19*19+quantise(factor[1])*19+quantise(factor[2]), 2)
+	}
+
+	return hash.String()
+}
+
+func writeBase83(hash *strings.Builder, value, length int) {
+	for i := 1; i <= length; i++ {
+		digit := value / int(math.Pow(83, float64(length-i))) % 83
+		hash.WriteByte(base83Chars[digit])
+	}
+}
+
+func srgbToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := max(0, min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
@@ -0,0 +1,173 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+
+	// Decoders for the formats thumbnails are made from
+	_ "image/gif"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxPixels caps the images that are decoded, since a small file can
+// describe an image that takes gigabytes of memory once decoded
+const MaxPixels = 50_000_000
+
+const (
+	thumbnailQuality = 80
+	// blurhashSize is the longest side of the copy a blurhash is computed
+	// from; the hash only keeps a few components, so more detail is wasted
+	blurhashSize = 32
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooManyPixels     = errors.New("image dimensions are too large")
+)
+
+// ImageInfo describes an image as it is displayed, after applying its EXIF orientation
+type ImageInfo struct {
+	Width     int
+	Height    int
+	Blurhash  string
+	Thumbnail Thumbnail
+}
+
+type Thumbnail struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// ProcessImage decodes an image to measure it and render a thumbnail that
+// fits in a square of thumbnailSize pixels. Thumbnails are JPEGs, or PNGs for
+// images with transparency, and carry no metadata.
+func ProcessImage(data []byte, thumbnailSize int) (*ImageInfo, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, ErrUnsupportedFormat
+		}
+		return nil, err
+	}
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+
+	// Scaling before rotating keeps the pixel-by-pixel rotation cheap
+	thumbnail := orient(resize(img, thumbnailSize), orientation)
+	encoded, err := encodeThumbnail(thumbnail)
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := config.Width, config.Height
+	if orientation >= 5 {
+		width, height = height, width
+	}
+
+	return &ImageInfo{
+		Width:     width,
+		Height:    height,
+		Blurhash:  Blurhash(resize(thumbnail, blurhashSize)),
+		Thumbnail: *encoded,
+	}, nil
+}
+
+// resize scales an image down to fit in a size by size square, keeping its
+// aspect ratio. Smaller images are copied at their own size.
+func resize(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, height*size/width)
+		} else {
+			width, height = max(1, width*size/height), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// orient turns an image upright according to an EXIF orientation value
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			var srcX, srcY int
+			switch orientation {
+			case 2: // mirrored
+				srcX, srcY = width-1-x, y
+			case 3: // rotated 180°
+				srcX, srcY = width-1-x, height-1-y
+			case 4: // flipped vertically
+				srcX, srcY = x, height-1-y
+			case 5: // transposed
+				srcX, srcY = y, x
+			case 6: // needs a clockwise turn
+				srcX, srcY = y, height-1-x
+			case 7: // transversed
+				srcX, srcY = width-1-y, height-1-x
+			case 8: // needs a counter-clockwise turn
+				srcX, srcY = width-1-y, x
+			}
+			dst.SetRGBA(x, y, img.RGBAAt(srcX, srcY))
+		}
+	}
+	return dst
+}
+
+func encodeThumbnail(img *image.RGBA) (*Thumbnail, error) {
+	var buf bytes.Buffer
+	contentType := "image/jpeg"
+
+	var err error
+	if img.Opaque() {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: thumbnailQuality})
+	} else {
+		contentType = "image/png"
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Thumbnail{
+		Data:        buf.Bytes(),
+		ContentType: contentType,
+		Width:       img.Rect.Dx(),
+		Height:      img.Rect.Dy(),
+	}, nil
+}
@@ -0,0 +1,320 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+var (
+	exifHeader        = []byte("Exif\x00\x00")
+	xmpHeader         = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtendedHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	pngSignature      = []byte("\x89PNG\r\n\x1a\n")
+)
+
+const (
+	tagOrientation = 0x0112
+	tagGPSInfo     = 0x8825
+)
+
+// StripLocation removes location data from an image's metadata. In JPEGs the
+// GPS fields of the EXIF block are blanked, keeping tags such as orientation,
+// and XMP packets are dropped. PNG and WebP files lose their EXIF and XMP
+// chunks. It reports false when there was nothing to remove or the format
+// isn't handled, in which case data is returned as is.
+func StripLocation(contentType string, data []byte) ([]byte, bool) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	default:
+		return data, false
+	}
+}
+
+// jpegSegment is a marker segment before the image data. Offsets are into the
+// file; payload excludes the marker and length bytes.
+type jpegSegment struct {
+	marker       byte
+	start, end   int
+	payloadStart int
+}
+
+// jpegSegments lists the segments up to the start of scan. It stops early at
+// anything malformed, leaving the rest of the file untouched.
+func jpegSegments(data []byte) []jpegSegment {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+
+	var segments []jpegSegment
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			break
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// Fill byte
+			pos++
+			continue
+		}
+		if marker == 0xD9 || marker == 0xDA {
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			break
+		}
+		segments = append(segments, jpegSegment{marker: marker, start: pos, end: end, payloadStart: pos + 4})
+		pos = end
+	}
+	return segments
+}
+
+func stripJPEG(data []byte) ([]byte, bool) {
+	var out bytes.Buffer
+	changed := false
+	copied := 0
+
+	for _, segment := range jpegSegments(data) {
+		if segment.marker != 0xE1 {
+			continue
+		}
+		payload := data[segment.payloadStart:segment.end]
+
+		switch {
+		case bytes.HasPrefix(payload, xmpHeader), bytes.HasPrefix(payload, xmpExtendedHeader):
+			out.Write(data[copied:segment.start])
+			copied = segment.end
+			changed = true
+		case bytes.HasPrefix(payload, exifHeader):
+			tiff := bytes.Clone(payload[len(exifHeader):])
+			if blankGPS(tiff) {
+				out.Write(data[copied : segment.payloadStart+len(exifHeader)])
+				out.Write(tiff)
+				copied = segment.end
+				changed = true
+			}
+		}
+	}
+
+	if !changed {
+		return data, false
+	}
+	out.Write(data[copied:])
+	return out.Bytes(), true
+}
+
+// jpegOrientation reads the EXIF orientation, 1 (upright) when there is none
+func jpegOrientation(data []byte) int {
+	for _, segment := range jpegSegments(data) {
+		payload := data[segment.payloadStart:segment.end]
+		if segment.marker != 0xE1 || !bytes.HasPrefix(payload, exifHeader) {
+			continue
+		}
+
+		tiff, ok := newTIFF(payload[len(exifHeader):])
+		if !ok {
+			return 1
+		}
+		for _, entry := range tiff.entries(tiff.firstIFD()) {
+			if entry.tag == tagOrientation && entry.typ == 3 {
+				if orientation := int(tiff.order.Uint16(entry.value)); orientation >= 1 && orientation <= 8 {
+					return orientation
+				}
+			}
+		}
+		return 1
+	}
+	return 1
+}
+
+// tiffBlock is the TIFF structure EXIF data is stored in
+type tiffBlock struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	// value holds the 4 bytes that are the value, or its offset when larger
+	value []byte
+}
+
+func newTIFF(data []byte) (*tiffBlock, bool) {
+	if len(data) < 8 {
+		return nil, false
+	}
+	switch string(data[:4]) {
+	case "II*\x00":
+		return &tiffBlock{data: data, order: binary.LittleEndian}, true
+	case "MM\x00*":
+		return &tiffBlock{data: data, order: binary.BigEndian}, true
+	default:
+		return nil, false
+	}
+}
+
+func (t *tiffBlock) firstIFD() int {
+	return int(t.order.Uint32(t.data[4:]))
+}
+
+// entries lists an IFD's entries, or nothing when the offset is out of bounds
+func (t *tiffBlock) entries(offset int) []ifdEntry {
+	if offset < 8 || offset+2 > len(t.data) {
+		return nil
+	}
+	count := int(t.order.Uint16(t.data[offset:]))
+	if offset+2+count*12 > len(t.data) {
+		return nil
+	}
+
+	entries := make([]ifdEntry, count)
+	for i := range entries {
+		pos := offset + 2 + i*12
+		entries[i] = ifdEntry{
+			tag:   t.order.Uint16(t.data[pos:]),
+			typ:   t.order.Uint16(t.data[pos+2:]),
+			count: t.order.Uint32(t.data[pos+4:]),
+			value: t.data[pos+8 : pos+12],
+		}
+	}
+	return entries
+}
+
+// tiffTypeSizes is the byte size of each TIFF field type, indexed by type
+var tiffTypeSizes = [...]int{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8}
+
+// blankGPS zeroes the GPS IFD in place, including values stored outside its
+// entries, and marks it empty. Offsets elsewhere in the block stay valid.
+func blankGPS(data []byte) bool {
+	tiff, ok := newTIFF(data)
+	if !ok {
+		return false
+	}
+
+	for _, entry := range tiff.entries(tiff.firstIFD()) {
+		if entry.tag != tagGPSInfo {
+			continue
+		}
+
+		gpsOffset := int(tiff.order.Uint32(entry.value))
+		gps := tiff.entries(gpsOffset)
+		if len(gps) == 0 {
+			return false
+		}
+
+		for _, field := range gps {
+			if int(field.typ) >= len(tiffTypeSizes) {
+				continue
+			}
+			size := int64(tiffTypeSizes[field.typ]) * int64(field.count)
+			if size <= 4 {
+				continue
+			}
+			start := int64(tiff.order.Uint32(field.value))
+			if start+size <= int64(len(data)) {
+				clear(data[start : start+size])
+			}
+		}
+
+		// Zeroing the count and entries leaves an empty IFD, whose next-IFD
+		// offset is read from the zeroed bytes right after the count
+		clear(data[gpsOffset : gpsOffset+2+len(gps)*12])
+		return true
+	}
+	return false
+}
+
+// stripPNG drops eXIf chunks and XMP text chunks, leaving the rest byte for byte
+func stripPNG(data []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return data, false
+	}
+
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	changed := false
+
+	for pos := len(pngSignature); pos < len(data); {
+		if pos+12 > len(data) {
+			out.Write(data[pos:])
+			break
+		}
+		length := int64(binary.BigEndian.Uint32(data[pos:]))
+		end := int64(pos) + 12 + length
+		if end > int64(len(data)) {
+			out.Write(data[pos:])
+			break
+		}
+
+		chunkType := string(data[pos+4 : pos+8])
+		body := data[pos+8 : pos+8+int(length)]
+		if chunkType == "eXIf" || (chunkType == "iTXt" && bytes.HasPrefix(body, []byte("XML:com.adobe.xmp\x00"))) {
+			changed = true
+		} else {
+			out.Write(data[pos:end])
+		}
+		pos = int(end)
+	}
+
+	if !changed {
+		return data, false
+	}
+	return out.Bytes(), true
+}
+
+// stripWebP drops the EXIF and XMP chunks of an extended WebP file and clears
+// their flags in the VP8X header
+func stripWebP(data []byte) ([]byte, bool) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return data, false
+	}
+
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	changed := false
+	vp8x := -1
+
+	for pos := 12; pos < len(data); {
+		if pos+8 > len(data) {
+			out = append(out, data[pos:]...)
+			break
+		}
+		size := int64(binary.LittleEndian.Uint32(data[pos+4:]))
+		// Chunks are padded to an even length
+		end := int64(pos) + 8 + size + size%2
+		if end > int64(len(data)) {
+			out = append(out, data[pos:]...)
+			break
+		}
+
+		switch string(data[pos : pos+4]) {
+		case "EXIF", "XMP ":
+			changed = true
+		case "VP8X":
+			vp8x = len(out)
+			fallthrough
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = int(end)
+	}
+
+	if !changed {
+		return data, false
+	}
+	if vp8x >= 0 && vp8x+9 <= len(out) {
+		// Bit 3 flags EXIF metadata and bit 2 XMP
+		out[vp8x+8] &^= 0x08 | 0x04
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, true
+}
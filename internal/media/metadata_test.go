@@ -0,0 +1,181 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// gpsLatitude marks the GPS values so tests can check they are gone
+var gpsLatitude = bytes.Repeat([]byte{0xAB}, 24)
+
+// testEXIF builds a little-endian TIFF block with an orientation tag and a GPS
+// IFD holding a latitude stored outside its entry
+func testEXIF(orientation uint16) []byte {
+	le := binary.LittleEndian
+	tiff := []byte("II*\x00")
+	tiff = le.AppendUint32(tiff, 8)
+
+	// IFD0 at 8: two entries and the next-IFD offset, so the GPS IFD is at 38
+	tiff = le.AppendUint16(tiff, 2)
+	tiff = le.AppendUint16(tiff, tagOrientation)
+	tiff = le.AppendUint16(tiff, 3)
+	tiff = le.AppendUint32(tiff, 1)
+	tiff = le.AppendUint16(tiff, orientation)
+	tiff = le.AppendUint16(tiff, 0)
+	tiff = le.AppendUint16(tiff, tagGPSInfo)
+	tiff = le.AppendUint16(tiff, 4)
+	tiff = le.AppendUint32(tiff, 1)
+	tiff = le.AppendUint32(tiff, 38)
+	tiff = le.AppendUint32(tiff, 0)
+
+	// GPS IFD at 38 with three rationals at 56
+	tiff = le.AppendUint16(tiff, 1)
+	tiff = le.AppendUint16(tiff, 0x0002)
+	tiff = le.AppendUint16(tiff, 5)
+	tiff = le.AppendUint32(tiff, 3)
+	tiff = le.AppendUint32(tiff, 56)
+	tiff = le.AppendUint32(tiff, 0)
+	return append(tiff, gpsLatitude...)
+}
+
+func jpegSegmentBytes(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func TestStripLocationJPEG(t *testing.T) {
+	xmp := jpegSegmentBytes(0xE1, append(bytes.Clone(xmpHeader), "<x:xmpmeta/>"...))
+
+	var data []byte
+	data = append(data, 0xFF, 0xD8)
+	data = append(data, jpegSegmentBytes(0xE1, append(bytes.Clone(exifHeader), testEXIF(6)...))...)
+	data = append(data, xmp...)
+	data = append(data, 0xFF, 0xDA, 0x00, 0x02, 0x12, 0x34, 0xFF, 0xD9)
+	original := bytes.Clone(data)
+
+	out, changed := StripLocation("image/jpeg", data)
+	if !changed {
+		t.Fatal("nothing was stripped")
+	}
+	if !bytes.Equal(data, original) {
+		t.Error("input was modified")
+	}
+	if bytes.Contains(out, gpsLatitude) {
+		t.Error("GPS values are still present")
+	}
+	if bytes.Contains(out, xmpHeader) {
+		t.Error("XMP segment is still present")
+	}
+	if len(out) != len(data)-len(xmp) {
+		t.Errorf("got %d bytes, want only the XMP segment removed from %d", len(out), len(data))
+	}
+	if got := jpegOrientation(out); got != 6 {
+		t.Errorf("got orientation %d, want 6", got)
+	}
+	if !bytes.HasSuffix(out, []byte{0xFF, 0xDA, 0x00, 0x02, 0x12, 0x34, 0xFF, 0xD9}) {
+		t.Error("image data was changed")
+	}
+
+	// Stripping is idempotent
+	if _, changed := StripLocation("image/jpeg", out); changed {
+		t.Error("stripped image was changed again")
+	}
+}
+
+func TestStripLocationJPEGWithoutMetadata(t *testing.T) {
+	data := []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9}
+	if out, changed := StripLocation("image/jpeg", data); changed || !bytes.Equal(out, data) {
+		t.Error("image without metadata was changed")
+	}
+}
+
+func pngChunk(chunkType string, body []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(body)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, body...)
+	// The CRC isn't checked when stripping
+	return append(chunk, 0, 0, 0, 0)
+}
+
+func TestStripLocationPNG(t *testing.T) {
+	header := pngChunk("IHDR", make([]byte, 13))
+	image := pngChunk("IDAT", []byte{1, 2, 3})
+	end := pngChunk("IEND", nil)
+
+	var data []byte
+	data = append(data, pngSignature...)
+	data = append(data, header...)
+	data = append(data, pngChunk("eXIf", testEXIF(1))...)
+	data = append(data, pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>"))...)
+	data = append(data, pngChunk("tEXt", []byte("Comment\x00hello"))...)
+	data = append(data, image...)
+	data = append(data, end...)
+
+	out, changed := StripLocation("image/png", data)
+	if !changed {
+		t.Fatal("nothing was stripped")
+	}
+
+	var want []byte
+	want = append(want, pngSignature...)
+	want = append(want, header...)
+	want = append(want, pngChunk("tEXt", []byte("Comment\x00hello"))...)
+	want = append(want, image...)
+	want = append(want, end...)
+	if !bytes.Equal(out, want) {
+		t.Error("expected only the eXIf and XMP chunks to be removed")
+	}
+}
+
+func webpChunk(fourCC string, body []byte) []byte {
+	chunk := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	chunk = append(chunk, body...)
+	if len(body)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func webpFile(chunks ...[]byte) []byte {
+	body := []byte("WEBP")
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+	}
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	return append(data, body...)
+}
+
+func TestStripLocationWebP(t *testing.T) {
+	// EXIF and XMP flags set, plus the alpha flag which must survive
+	header := make([]byte, 10)
+	header[0] = 0x08 | 0x04 | 0x10
+	image := webpChunk("VP8L", []byte{1, 2, 3})
+
+	data := webpFile(
+		webpChunk("VP8X", header),
+		image,
+		webpChunk("EXIF", testEXIF(1)),
+		webpChunk("XMP ", []byte("<x:xmpmeta/>!")),
+	)
+
+	out, changed := StripLocation("image/webp", data)
+	if !changed {
+		t.Fatal("nothing was stripped")
+	}
+
+	stripped := bytes.Clone(header)
+	stripped[0] = 0x10
+	want := webpFile(webpChunk("VP8X", stripped), image)
+	if !bytes.Equal(out, want) {
+		t.Errorf("got %x, want %x", out, want)
+	}
+}
+
+func TestStripLocationUnhandledType(t *testing.T) {
+	data := []byte("GIF89a")
+	if out, changed := StripLocation("image/gif", data); changed || !bytes.Equal(out, data) {
+		t.Error("unhandled type was changed")
+	}
+}
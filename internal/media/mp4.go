@@ -0,0 +1,172 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// maxMovieBoxSize caps how much of the moov box is read into memory; it holds
+// the sample tables, which grow with the length of the video
+const maxMovieBoxSize = 32 << 20
+
+var ErrInvalidMP4 = errors.New("invalid MP4 file")
+
+// VideoInfo describes a video. Width and Height are zero for files without a
+// video track, such as MP4 audio.
+type VideoInfo struct {
+	Width    int
+	Height   int
+	Duration time.Duration
+}
+
+type mp4Box struct {
+	boxType string
+	// size of the box body, after its header
+	size int64
+}
+
+// ProbeMP4 reads the duration and dimensions of an MP4 or QuickTime file from
+// its moov box. Only box headers are read on the way, so the media data is
+// skipped even when moov comes after it.
+func ProbeMP4(r io.ReadSeeker) (*VideoInfo, error) {
+	for {
+		box, err := readMP4Box(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, ErrInvalidMP4
+			}
+			return nil, err
+		}
+
+		if box.boxType != "moov" {
+			if _, err := r.Seek(box.size, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if box.size > maxMovieBoxSize {
+			return nil, ErrInvalidMP4
+		}
+		moov := make([]byte, box.size)
+		if _, err := io.ReadFull(r, moov); err != nil {
+			return nil, err
+		}
+		return parseMovieBox(moov)
+	}
+}
+
+// readMP4Box reads a box header, leaving r at the start of the body
+func readMP4Box(r io.ReadSeeker) (*mp4Box, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := int64(binary.BigEndian.Uint32(header[:4]))
+	headerSize := int64(8)
+	switch size {
+	case 0:
+		// The box runs to the end of the file
+		here, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		end, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := r.Seek(here, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return &mp4Box{boxType: string(header[4:]), size: end - here}, nil
+	case 1:
+		var large [8]byte
+		if _, err := io.ReadFull(r, large[:]); err != nil {
+			return nil, err
+		}
+		size = int64(binary.BigEndian.Uint64(large[:]))
+		headerSize = 16
+	}
+
+	if size < headerSize {
+		return nil, ErrInvalidMP4
+	}
+	return &mp4Box{boxType: string(header[4:]), size: size - headerSize}, nil
+}
+
+// mp4Children splits a box body into its child boxes
+func mp4Children(data []byte) map[string][][]byte {
+	children := make(map[string][][]byte)
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data))
+		headerSize := uint64(8)
+		if size == 1 && len(data) >= 16 {
+			size = binary.BigEndian.Uint64(data[8:])
+			headerSize = 16
+		} else if size == 0 {
+			size = uint64(len(data))
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			break
+		}
+
+		boxType := string(data[4:8])
+		children[boxType] = append(children[boxType], data[headerSize:size])
+		data = data[size:]
+	}
+	return children
+}
+
+func parseMovieBox(moov []byte) (*VideoInfo, error) {
+	children := mp4Children(moov)
+	if len(children["mvhd"]) == 0 {
+		return nil, ErrInvalidMP4
+	}
+
+	// mvhd: version and flags, creation and modification times, then the
+	// timescale and duration, with 64-bit times and duration in version 1
+	mvhd := children["mvhd"][0]
+	var timescale, duration uint64
+	switch {
+	case len(mvhd) >= 20 && mvhd[0] == 0:
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[12:]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:]))
+	case len(mvhd) >= 32 && mvhd[0] == 1:
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[20:]))
+		duration = binary.BigEndian.Uint64(mvhd[24:])
+	default:
+		return nil, ErrInvalidMP4
+	}
+
+	info := &VideoInfo{}
+	if timescale > 0 {
+		info.Duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+	}
+
+	// The first track with a picture size is the video. tkhd ends with the
+	// width and height as 16.16 fixed-point numbers.
+	for _, trak := range children["trak"] {
+		for _, tkhd := range mp4Children(trak)["tkhd"] {
+			if len(tkhd) < 84 {
+				continue
+			}
+			width := int(binary.BigEndian.Uint32(tkhd[len(tkhd)-8:]) >> 16)
+			height := int(binary.BigEndian.Uint32(tkhd[len(tkhd)-4:]) >> 16)
+			if width > 0 && height > 0 {
+				// The display matrix precedes them; a quarter turn, as phones
+				// record portrait video, zeroes its a and d entries
+				matrix := tkhd[len(tkhd)-44 : len(tkhd)-8]
+				if binary.BigEndian.Uint32(matrix[0:]) == 0 && binary.BigEndian.Uint32(matrix[16:]) == 0 {
+					width, height = height, width
+				}
+				info.Width, info.Height = width, height
+				return info, nil
+			}
+		}
+	}
+
+	return info, nil
+}
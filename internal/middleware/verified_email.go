@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/kevinsofyan/echoes-chat-api/internal/services"
+	"github.com/kevinsofyan/echoes-chat-api/internal/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// RequireVerifiedEmail rejects unverified accounts when the policy is restrict.
+// Under the other policies it lets every request through: off doesn't require
+// verification, and block already refuses unverified users at login.
+func RequireVerifiedEmail(verificationService services.EmailVerificationService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if verificationService.Policy() != services.VerificationRestrict {
+			return next
+		}
+
+		return func(c echo.Context) error {
+			userID, err := utils.GetUserIDFromContext(c)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+
+			verified, err := verificationService.IsVerified(c.Request().Context(), userID)
+			if err != nil {
+				log.Printf("error checking email verification for user %s: %v", userID, err)
+				return echo.NewHTTPError(http.StatusInternalServerError, map[string]interface{}{
+					"error": "Failed to check email verification",
+				})
+			}
+			if !verified {
+				return echo.NewHTTPError(http.StatusForbidden, map[string]interface{}{
+					"error": services.ErrEmailNotVerified.Error(),
+				})
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AttachmentStatus string
+
+const (
+	// AttachmentStatusProcessing is set on upload, until the file is scanned
+	// and its metadata and thumbnails are extracted
+	AttachmentStatusProcessing AttachmentStatus = "processing"
+	AttachmentStatusReady      AttachmentStatus = "ready"
+	// AttachmentStatusFailed means the file passed scanning but couldn't be
+	// processed; it is still served as is
+	AttachmentStatusFailed AttachmentStatus = "failed"
+	// AttachmentStatusQuarantined means scanning flagged the file, or its
+	// location data couldn't be stripped. It is never served again.
+	AttachmentStatusQuarantined AttachmentStatus = "quarantined"
+)
+
+// Attachment is an uploaded file. It belongs to its uploader until it is sent
+// with a message, after which it is visible to the message's room.
+type Attachment struct {
+	BaseModel
+	UploaderID  uuid.UUID        `gorm:"type:uuid;not null;index" json:"uploader_id"`
+	MessageID   *uuid.UUID       `gorm:"type:uuid;index" json:"message_id,omitempty"`
+	Filename    string           `gorm:"size:255;not null" json:"filename"`
+	ContentType string           `gorm:"size:100;not null" json:"content_type"`
+	Size        int64            `gorm:"not null" json:"size"`
+	StorageKey  string           `gorm:"size:255;not null" json:"-"`
+	Status      AttachmentStatus `gorm:"size:20;not null;default:processing" json:"status"`
+
+	ScannedAt *time.Time `json:"scanned_at,omitempty"`
+	// ScanSignature is what the scanner found in a quarantined file
+	ScanSignature string `gorm:"size:255" json:"-"`
+
+	// Media metadata, filled in by processing
+	Width                *int       `json:"width,omitempty"`
+	Height               *int       `json:"height,omitempty"`
+	DurationMs           *int64     `json:"duration_ms,omitempty"`
+	Blurhash             string     `gorm:"size:100" json:"blurhash,omitempty"`
+	ThumbnailKey         string     `gorm:"size:255" json:"-"`
+	ThumbnailContentType string     `gorm:"size:100" json:"-"`
+	ThumbnailWidth       *int       `json:"thumbnail_width,omitempty"`
+	ThumbnailHeight      *int       `json:"thumbnail_height,omitempty"`
+	ProcessedAt          *time.Time `json:"processed_at,omitempty"`
+}
+
+func (Attachment) TableName() string {
+	return "attachments"
+}
+
+// IsCleared reports whether the file passed scanning and may be shown to others
+func (a *Attachment) IsCleared() bool {
+	return a.Status == AttachmentStatusReady || a.Status == AttachmentStatusFailed
+}
+
+// Kind is the message type matching the attachment's sniffed content type
+func (a *Attachment) Kind() MessageType {
+	return MessageTypeForContentType(a.ContentType)
+}
+
+func MessageTypeForContentType(contentType string) MessageType {
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return MessageTypeImage
+	case strings.HasPrefix(contentType, "video/"):
+		return MessageTypeVideo
+	case strings.HasPrefix(contentType, "audio/"):
+		return MessageTypeAudio
+	default:
+		return MessageTypeFile
+	}
+}
+
+// UploadSession tracks a resumable upload sent in chunks. Received bytes are
+// staged on local disk until Offset reaches Size.
+type UploadSession struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UploaderID   uuid.UUID  `gorm:"type:uuid;not null;index" json:"uploader_id"`
+	Filename     string     `gorm:"size:255;not null" json:"filename"`
+	ContentType  string     `gorm:"size:100" json:"content_type,omitempty"`
+	Size         int64      `gorm:"not null" json:"size"`
+	Offset       int64      `gorm:"column:upload_offset;not null;default:0" json:"offset"`
+	AttachmentID *uuid.UUID `gorm:"type:uuid" json:"attachment_id,omitempty"`
+	ExpiresAt    time.Time  `gorm:"not null" json:"expires_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (UploadSession) TableName() string {
+	return "upload_sessions"
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LoginFailureReason string
+
+const (
+	LoginFailureUnknownEmail  LoginFailureReason = "unknown_email"
+	LoginFailureWrongPassword LoginFailureReason = "wrong_password"
+	LoginFailureTwoFactorCode LoginFailureReason = "two_factor_code"
+	LoginFailureLockedOut     LoginFailureReason = "locked_out"
+)
+
+// LoginFailure is an audit record of a rejected sign-in attempt
+type LoginFailure struct {
+	ID        uuid.UUID          `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID    *uuid.UUID         `gorm:"type:uuid;index" json:"user_id,omitempty"`
+	Email     string             `gorm:"size:100;not null" json:"email"`
+	IPAddress string             `gorm:"size:45" json:"ip_address"`
+	UserAgent string             `gorm:"type:text" json:"user_agent"`
+	Reason    LoginFailureReason `gorm:"size:30;not null" json:"reason"`
+	CreatedAt time.Time          `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (LoginFailure) TableName() string {
+	return "login_failures"
+}
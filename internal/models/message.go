@@ -23,11 +23,27 @@ type Message struct {
 	ReplyToID *uuid.UUID  `gorm:"type:uuid;index" json:"reply_to_id,omitempty"`
 
 	// Relationships
-	Room    Room     `gorm:"foreignKey:RoomID" json:"room,omitempty"`
-	Sender  User     `gorm:"foreignKey:SenderID" json:"sender,omitempty"`
-	ReplyTo *Message `gorm:"foreignKey:ReplyToID" json:"reply_to,omitempty"`
+	Room        Room         `gorm:"foreignKey:RoomID" json:"room,omitempty"`
+	Sender      User         `gorm:"foreignKey:SenderID" json:"sender,omitempty"`
+	ReplyTo     *Message     `gorm:"foreignKey:ReplyToID" json:"reply_to,omitempty"`
+	Attachments []Attachment `gorm:"foreignKey:MessageID" json:"attachments,omitempty"`
+
+	// Reactions are counted per emoji for the user viewing the message, in the
+	// order the emoji were first used. They are only filled in by the message service.
+	Reactions []ReactionCount `gorm:"-" json:"reactions,omitempty"`
 }
 
 func (Message) TableName() string {
 	return "messages"
 }
+
+// IsWithheld reports whether the message is held back from everyone but its
+// sender because an attachment hasn't passed scanning. Attachments must be loaded.
+func (m *Message) IsWithheld() bool {
+	for i := range m.Attachments {
+		if !m.Attachments[i].IsCleared() {
+			return true
+		}
+	}
+	return false
+}
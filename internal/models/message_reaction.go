@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MessageReaction is an emoji a user reacted to a message with.
+// A user can react with several emoji, but with each one only once.
+type MessageReaction struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	MessageID uuid.UUID `gorm:"type:uuid;not null" json:"message_id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	Emoji     string    `gorm:"size:64;not null" json:"emoji"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (MessageReaction) TableName() string {
+	return "message_reactions"
+}
+
+// Composite unique index
+func (MessageReaction) TableIndexes() []string {
+	return []string{
+		"idx_message_reactions_message_user_emoji:message_id,user_id,emoji,unique",
+	}
+}
+
+// ReactionCount totals the reactions with one emoji on a message
+type ReactionCount struct {
+	MessageID uuid.UUID `json:"-"`
+	Emoji     string    `json:"emoji"`
+	Count     int64     `json:"count"`
+	// Reacted reports whether the user viewing the message is among them
+	Reacted bool `json:"reacted"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OIDCIdentity links a user to their account at an OIDC provider
+type OIDCIdentity struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	Provider  string    `gorm:"size:50;not null" json:"provider"`
+	Subject   string    `gorm:"size:255;not null" json:"-"`
+	Email     string    `gorm:"size:100" json:"email"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (OIDCIdentity) TableName() string {
+	return "oidc_identities"
+}
+
+// OIDCLoginState is created when a user is sent to a provider and consumed by
+// the callback. Only the state's SHA-256 hash is stored.
+type OIDCLoginState struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Provider     string     `gorm:"size:50;not null" json:"provider"`
+	StateHash    string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	CodeVerifier string     `gorm:"size:128;not null" json:"-"`
+	Nonce        string     `gorm:"size:128;not null" json:"-"`
+	ExpiresAt    time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt       *time.Time `json:"used_at,omitempty"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (OIDCLoginState) TableName() string {
+	return "oidc_login_states"
+}
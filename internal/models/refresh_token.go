@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken is an opaque, single-use token exchanged for a new access token.
+// Only its SHA-256 hash is stored. Every token descending from one login shares
+// a FamilyID, so a replayed token can revoke the whole chain.
+type RefreshToken struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	FamilyID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"family_id"`
+	TokenHash     string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	AccessTokenID uuid.UUID  `gorm:"type:uuid;not null" json:"-"`
+	ExpiresAt     time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt        *time.Time `json:"used_at,omitempty"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	ReplacedByID  *uuid.UUID `gorm:"type:uuid" json:"replaced_by_id,omitempty"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
@@ -26,3 +26,10 @@ type Room struct {
 func (Room) TableName() string {
 	return "rooms"
 }
+
+// RoomSummary is a room as listed for one of its members, with their unread state
+type RoomSummary struct {
+	Room
+	UnreadCount int64    `json:"unread_count"`
+	LastMessage *Message `json:"last_message,omitempty"`
+}
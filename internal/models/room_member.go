@@ -36,3 +36,17 @@ func (RoomMember) TableIndexes() []string {
 		"idx_room_user:room_id,user_id,unique",
 	}
 }
+
+// Rank orders roles by privilege so permission checks can compare them
+func (r RoomMemberRole) Rank() int {
+	switch r {
+	case RoleOwner:
+		return 3
+	case RoleAdmin:
+		return 2
+	case RoleMember:
+		return 1
+	default:
+		return 0
+	}
+}
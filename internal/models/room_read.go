@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RoomRead records how far a user has read in a room
+type RoomRead struct {
+	BaseModel
+	RoomID            uuid.UUID `gorm:"type:uuid;not null" json:"room_id"`
+	UserID            uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
+	LastReadMessageID uuid.UUID `gorm:"type:uuid;not null" json:"last_read_message_id"`
+	LastReadAt        time.Time `gorm:"not null" json:"last_read_at"`
+}
+
+func (RoomRead) TableName() string {
+	return "room_reads"
+}
+
+// Composite unique index
+func (RoomRead) TableIndexes() []string {
+	return []string{
+		"idx_room_reads_room_user:room_id,user_id,unique",
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is one signed-in device. It spans every access and refresh token
+// issued from a single login; refresh tokens use the session ID as their family.
+type Session struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	UserAgent  string     `gorm:"type:text" json:"user_agent"`
+	IPAddress  string     `gorm:"type:varchar(45)" json:"ip_address"`
+	LastUsedAt time.Time  `gorm:"not null" json:"last_used_at"`
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// Current marks the session making the request
+	Current bool `gorm:"-" json:"current"`
+}
+
+func (Session) TableName() string {
+	return "sessions"
+}
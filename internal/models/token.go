@@ -10,6 +10,8 @@ type Token struct {
 	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
 	UserID    uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
 	Token     string    `gorm:"type:text;not null;uniqueIndex" json:"token"`
+	JTI       uuid.UUID `gorm:"column:jti;type:uuid;uniqueIndex" json:"jti"`
+	SessionID uuid.UUID `gorm:"type:uuid;index" json:"session_id"`
 	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
@@ -2,6 +2,14 @@ package models
 
 import "time"
 
+type PresenceStatus string
+
+const (
+	PresenceOnline  PresenceStatus = "online"
+	PresenceAway    PresenceStatus = "away"
+	PresenceOffline PresenceStatus = "offline"
+)
+
 type User struct {
 	BaseModel
 	Username string `gorm:"uniqueIndex;not null;size:50" json:"username"`
@@ -13,6 +21,13 @@ type User struct {
 
 	LastSeen time.Time `json:"last_seen"`
 
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+
+	// TwoFactorSecret is sealed with a secretbox.Box, keyed to the user's ID
+	TwoFactorSecret    string     `gorm:"type:text" json:"-"`
+	TwoFactorEnabledAt *time.Time `json:"two_factor_enabled_at"`
+	TwoFactorLastStep  *int64     `json:"-"`
+
 	// Relationships
 	Messages     []Message    `gorm:"foreignKey:SenderID" json:"messages,omitempty"`
 	RoomMembers  []RoomMember `gorm:"foreignKey:UserID" json:"room_members,omitempty"`
@@ -0,0 +1,73 @@
+package oidc
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+var defaultScopes = []string{"openid", "email", "profile"}
+
+// Config describes one identity provider registered with this API as an OIDC client
+type Config struct {
+	// Name identifies the provider in /auth/oidc/:provider routes
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is this API's callback, as registered with the provider
+	RedirectURL string
+	Scopes      []string
+}
+
+// ConfigsFromEnv reads OIDC_PROVIDERS, a comma-separated list of provider
+// names, then for each name OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID,
+// OIDC_<NAME>_CLIENT_SECRET, OIDC_<NAME>_REDIRECT_URL and optionally
+// OIDC_<NAME>_SCOPES (space-separated). Dashes in names become underscores,
+// so provider "corp-sso" reads OIDC_CORP_SSO_ISSUER.
+func ConfigsFromEnv() ([]Config, error) {
+	spec := strings.TrimSpace(os.Getenv("OIDC_PROVIDERS"))
+	if spec == "" {
+		return nil, nil
+	}
+
+	var configs []Config
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		name := strings.ToLower(strings.TrimSpace(entry))
+		if !providerNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid OIDC provider name %q", entry)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate OIDC provider %q", name)
+		}
+		seen[name] = true
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		config := Config{
+			Name:         name,
+			Issuer:       strings.TrimSpace(os.Getenv(prefix + "ISSUER")),
+			ClientID:     strings.TrimSpace(os.Getenv(prefix + "CLIENT_ID")),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  strings.TrimSpace(os.Getenv(prefix + "REDIRECT_URL")),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+			return nil, fmt.Errorf("OIDC provider %s needs %sISSUER, %sCLIENT_ID and %sREDIRECT_URL", name, prefix, prefix, prefix)
+		}
+		if len(config.Scopes) == 0 {
+			config.Scopes = defaultScopes
+		} else if !slices.Contains(config.Scopes, "openid") {
+			// Without it the provider doesn't return an ID token
+			config.Scopes = append([]string{"openid"}, config.Scopes...)
+		}
+
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
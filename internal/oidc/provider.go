@@ -0,0 +1,310 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kevinsofyan/echoes-chat-api/internal/signing"
+)
+
+var (
+	ErrExchangeFailed = errors.New("authorization code exchange failed")
+	ErrInvalidIDToken = errors.New("invalid ID token")
+)
+
+const (
+	maxResponseSize = 1 << 20
+	// keyRefreshInterval limits how often an unknown kid can trigger a JWKS fetch
+	keyRefreshInterval = time.Minute
+)
+
+// idTokenAlgorithms are the signing algorithms accepted on ID tokens; "none" and shared secrets never are
+var idTokenAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// Claims are the ID token claims used to sign a user in
+type Claims struct {
+	jwt.RegisteredClaims
+	Nonce             string   `json:"nonce"`
+	AuthorizedParty   string   `json:"azp,omitempty"`
+	Email             string   `json:"email"`
+	EmailVerified     flexBool `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// flexBool accepts both true and "true"; some providers send email_verified as a string
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	case "false", "null":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Provider signs users in with an OIDC provider using the authorization code
+// flow with PKCE. Its discovery document and keys are fetched on first use.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu          sync.Mutex
+	discovery   *discoveryDocument
+	keys        signing.JWKS
+	keysFetched time.Time
+}
+
+func NewProvider(config Config) *Provider {
+	return &Provider{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// AuthCodeURL is where the user is sent to sign in. The provider is given the
+// S256 challenge of verifier, and Exchange must be called with verifier itself.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(doc.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified ID token claims
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.config.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		// client_secret_basic; public clients rely on PKCE alone
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchangeFailed, err)
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&token); err != nil {
+		return nil, fmt.Errorf("%w: status %d", ErrExchangeFailed, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrExchangeFailed, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in response", ErrExchangeFailed)
+	}
+
+	return p.verifyIDToken(ctx, doc, token.IDToken, nonce)
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, doc *discoveryDocument, rawIDToken, nonce string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(rawIDToken, &claims,
+		func(token *jwt.Token) (interface{}, error) {
+			return p.verificationKey(ctx, token)
+		},
+		jwt.WithValidMethods(idTokenAlgorithms),
+		jwt.WithIssuer(doc.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID {
+		return nil, fmt.Errorf("%w: azp does not match client", ErrInvalidIDToken)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	return &claims, nil
+}
+
+// verificationKey finds the key an ID token was signed with. An unknown kid
+// usually means the provider rotated keys, so the key set is fetched again.
+func (p *Provider) verificationKey(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	p.mu.Lock()
+	keys, fetched := p.keys, p.keysFetched
+	p.mu.Unlock()
+
+	jwk, ok := findKey(keys, kid)
+	if !ok && time.Since(fetched) > keyRefreshInterval {
+		var err error
+		if keys, err = p.fetchKeys(ctx); err != nil {
+			return nil, err
+		}
+		jwk, ok = findKey(keys, kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	if jwk.Alg != "" && jwk.Alg != token.Method.Alg() {
+		return nil, fmt.Errorf("key %q is for %s, not %s", kid, jwk.Alg, token.Method.Alg())
+	}
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return nil, fmt.Errorf("key %q is not a signing key", kid)
+	}
+
+	return jwk.PublicKey()
+}
+
+// findKey looks a key up by kid; tokens without one may only use a single-key set
+func findKey(keys signing.JWKS, kid string) (signing.JWK, bool) {
+	if kid == "" {
+		if len(keys.Keys) == 1 {
+			return keys.Keys[0], true
+		}
+		return signing.JWK{}, false
+	}
+	return keys.Find(kid)
+}
+
+func (p *Provider) discover(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	doc := p.discovery
+	p.mu.Unlock()
+	if doc != nil {
+		return doc, nil
+	}
+
+	discoveryURL := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	doc = &discoveryDocument{}
+	if err := p.getJSON(ctx, discoveryURL, doc); err != nil {
+		return nil, fmt.Errorf("OIDC discovery for %s failed: %w", p.config.Name, err)
+	}
+
+	if doc.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("OIDC discovery for %s returned issuer %q, expected %q", p.config.Name, doc.Issuer, p.config.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery for %s is missing endpoints", p.config.Name)
+	}
+
+	p.mu.Lock()
+	p.discovery = doc
+	p.mu.Unlock()
+	return doc, nil
+}
+
+func (p *Provider) fetchKeys(ctx context.Context) (signing.JWKS, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return signing.JWKS{}, err
+	}
+
+	var keys signing.JWKS
+	if err := p.getJSON(ctx, doc.JWKSURI, &keys); err != nil {
+		return signing.JWKS{}, fmt.Errorf("fetching keys for %s failed: %w", p.config.Name, err)
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.keysFetched = time.Now()
+	p.mu.Unlock()
+	return keys, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, target)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
+
+// CodeChallenge is the PKCE S256 challenge for a code verifier (RFC 7636)
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
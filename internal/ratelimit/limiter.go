@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Policy configures how a Limiter backs off
+type Policy struct {
+	// FreeAttempts is how many failures are allowed before the key is locked
+	FreeAttempts int
+	// BaseLockout is the first lockout; each further failure doubles it up to MaxLockout
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	// Window is how long failures are remembered after the last one
+	Window time.Duration
+}
+
+// Limiter applies exponential backoff to repeated failures on a key
+type Limiter struct {
+	store  Store
+	policy Policy
+}
+
+func NewLimiter(store Store, policy Policy) *Limiter {
+	return &Limiter{store: store, policy: policy}
+}
+
+// Reservation is the outcome of counting an attempt
+type Reservation struct {
+	// Wait is how long the key remains locked. The attempt may only proceed when it's zero.
+	Wait time.Duration
+	// Lockout is set when this attempt locked the key for the attempts after it
+	Lockout time.Duration
+}
+
+// Reserve counts an attempt as a failure before it is made, so concurrent
+// attempts can't all get in before any of them is recorded. Attempts that turn
+// out not to fail are handed back with Release or Success.
+func (l *Limiter) Reserve(ctx context.Context, key string) (Reservation, error) {
+	entry, ok, err := l.store.Reserve(ctx, key, l.policy.Window, l.lockout)
+	if err != nil {
+		return Reservation{}, err
+	}
+	if !ok {
+		return Reservation{Wait: time.Until(entry.LockedUntil)}, nil
+	}
+	return Reservation{Lockout: l.lockout(entry.Failures)}, nil
+}
+
+// Release takes back an attempt that didn't fail, keeping earlier failures
+func (l *Limiter) Release(ctx context.Context, key string) error {
+	return l.store.Release(ctx, key)
+}
+
+// Success clears the key's failures
+func (l *Limiter) Success(ctx context.Context, key string) error {
+	return l.store.Reset(ctx, key)
+}
+
+// lockout is how long the key is locked once it has failures failures
+func (l *Limiter) lockout(failures int) time.Duration {
+	over := failures - l.policy.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+
+	lockout := l.policy.BaseLockout
+	for i := 1; i < over && lockout < l.policy.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > l.policy.MaxLockout {
+		lockout = l.policy.MaxLockout
+	}
+	return lockout
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts: 3,
+	BaseLockout:  time.Minute,
+	MaxLockout:   4 * time.Minute,
+	Window:       time.Hour,
+}
+
+func TestReserveLocksAfterFreeAttempts(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewLimiter(NewMemoryStore(), testPolicy)
+
+	for i := 0; i < testPolicy.FreeAttempts; i++ {
+		reservation, err := limiter.Reserve(ctx, "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reservation.Wait != 0 || reservation.Lockout != 0 {
+			t.Fatalf("attempt %d: got %+v, want a free attempt", i+1, reservation)
+		}
+	}
+
+	// The first attempt over the limit still goes ahead but locks the key
+	reservation, err := limiter.Reserve(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation.Wait != 0 || reservation.Lockout != testPolicy.BaseLockout {
+		t.Fatalf("got %+v, want the attempt to proceed and lock for %s", reservation, testPolicy.BaseLockout)
+	}
+
+	reservation, err = limiter.Reserve(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation.Wait <= 0 || reservation.Wait > testPolicy.BaseLockout {
+		t.Fatalf("got wait %s, want up to %s", reservation.Wait, testPolicy.BaseLockout)
+	}
+}
+
+func TestReserveUnderConcurrency(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewLimiter(NewMemoryStore(), testPolicy)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reservation, err := limiter.Reserve(ctx, "key")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if reservation.Wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The free attempts plus the one that locks the key
+	if want := testPolicy.FreeAttempts + 1; allowed != want {
+		t.Fatalf("%d attempts went ahead, want %d", allowed, want)
+	}
+}
+
+func TestReleaseAndSuccess(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewLimiter(NewMemoryStore(), testPolicy)
+
+	// Released attempts don't count towards the limit
+	for i := 0; i < 10; i++ {
+		if _, err := limiter.Reserve(ctx, "key"); err != nil {
+			t.Fatal(err)
+		}
+		if err := limiter.Release(ctx, "key"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reservation, err := limiter.Reserve(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation.Lockout != 0 {
+		t.Fatalf("released attempts were counted: %+v", reservation)
+	}
+
+	for i := 0; i < testPolicy.FreeAttempts; i++ {
+		limiter.Reserve(ctx, "key")
+	}
+	if err := limiter.Success(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	reservation, err = limiter.Reserve(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation.Wait != 0 || reservation.Lockout != 0 {
+		t.Fatalf("got %+v after success, want a fresh key", reservation)
+	}
+}
+
+func TestLockoutBacksOff(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), testPolicy)
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{3, 0},
+		{4, time.Minute},
+		{5, 2 * time.Minute},
+		{6, 4 * time.Minute},
+		{7, 4 * time.Minute},
+		{100, 4 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := limiter.lockout(tt.failures); got != tt.want {
+			t.Errorf("lockout(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
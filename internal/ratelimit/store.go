@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Entry is the failure history kept for one key
+type Entry struct {
+	Failures    int
+	LockedUntil time.Time
+}
+
+// Store keeps failure counts. The in-memory store suits a single instance;
+// a shared store such as Redis can implement this to rate limit across instances.
+type Store interface {
+	// Reserve counts an attempt unless the key is locked, reporting whether it
+	// was counted. It must check, count and lock in one atomic step. lockout is
+	// given the new count and returns how long to lock the key for, if at all.
+	// The entry is forgotten ttl after the last attempt or when the lock ends,
+	// whichever is later.
+	Reserve(ctx context.Context, key string, ttl time.Duration, lockout func(failures int) time.Duration) (Entry, bool, error)
+	// Release takes back one counted attempt
+	Release(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+const maxMemoryStoreEntries = 100000
+
+type memoryEntry struct {
+	Entry
+	expires time.Time
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+func (s *memoryStore) Reserve(ctx context.Context, key string, ttl time.Duration, lockout func(failures int) time.Duration) (Entry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry := s.live(key, now)
+	if entry != nil && now.Before(entry.LockedUntil) {
+		return entry.Entry, false, nil
+	}
+	if entry == nil {
+		if len(s.entries) >= maxMemoryStoreEntries {
+			s.prune(now)
+		}
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+
+	entry.Failures++
+	entry.expires = now.Add(ttl)
+	if wait := lockout(entry.Failures); wait > 0 {
+		entry.LockedUntil = now.Add(wait)
+	}
+	if entry.LockedUntil.After(entry.expires) {
+		entry.expires = entry.LockedUntil
+	}
+	return entry.Entry, true, nil
+}
+
+func (s *memoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry := s.live(key, time.Now()); entry != nil && entry.Failures > 0 {
+		entry.Failures--
+	}
+	return nil
+}
+
+func (s *memoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// live returns the entry for key unless it has expired. It must be called with s.mu held.
+func (s *memoryStore) live(key string, now time.Time) *memoryEntry {
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if now.After(entry.expires) {
+		delete(s.entries, key)
+		return nil
+	}
+	return entry
+}
+
+// prune must be called with s.mu held
+func (s *memoryStore) prune(now time.Time) {
+	for key, entry := range s.entries {
+		if now.After(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
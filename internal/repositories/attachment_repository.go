@@ -0,0 +1,220 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAttachmentNotFound    = errors.New("attachment not found")
+	ErrAttachmentUnavailable = errors.New("attachment already sent or not owned by the sender")
+	ErrUploadSessionNotFound = errors.New("upload session not found or expired")
+)
+
+type AttachmentRepository interface {
+	Create(ctx context.Context, attachment *models.Attachment) error
+	FindByID(ctx context.Context, id uuid.UUID) (*models.Attachment, error)
+	FindByIDs(ctx context.Context, ids []uuid.UUID) ([]models.Attachment, error)
+	// FindProcessing lists attachments still waiting to be processed, oldest first
+	FindProcessing(ctx context.Context) ([]models.Attachment, error)
+	// CompleteProcessing saves the status, scan, storage and media fields of
+	// an attachment, reporting false if it was no longer being processed
+	CompleteProcessing(ctx context.Context, attachment *models.Attachment) (bool, error)
+	// FindUnsent lists attachments uploaded before the given time that were
+	// never sent with a message, oldest first. Those still being processed are skipped.
+	FindUnsent(ctx context.Context, before time.Time, limit int) ([]models.Attachment, error)
+	// DeleteUnsent deletes an attachment unless it was sent in the meantime,
+	// reporting whether it was deleted
+	DeleteUnsent(ctx context.Context, id uuid.UUID) (bool, error)
+	// UnsentUsage totals the uploader's attachments not yet sent with a message
+	UnsentUsage(ctx context.Context, uploaderID uuid.UUID) (UploadUsage, error)
+}
+
+// UploadUsage is how many uploads a user holds and their total size in bytes
+type UploadUsage struct {
+	Count int64
+	Bytes int64
+}
+
+type attachmentRepository struct {
+	db *gorm.DB
+}
+
+func NewAttachmentRepository(db *gorm.DB) AttachmentRepository {
+	return &attachmentRepository{db: db}
+}
+
+func (r *attachmentRepository) Create(ctx context.Context, attachment *models.Attachment) error {
+	return r.db.WithContext(ctx).Create(attachment).Error
+}
+
+func (r *attachmentRepository) FindByID(ctx context.Context, id uuid.UUID) (*models.Attachment, error) {
+	var attachment models.Attachment
+	err := r.db.WithContext(ctx).First(&attachment, "id = ?", id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+func (r *attachmentRepository) FindByIDs(ctx context.Context, ids []uuid.UUID) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&attachments).Error
+	return attachments, err
+}
+
+func (r *attachmentRepository) FindProcessing(ctx context.Context) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	err := r.db.WithContext(ctx).
+		Where("status = ?", models.AttachmentStatusProcessing).
+		Order("created_at ASC").
+		Find(&attachments).Error
+	return attachments, err
+}
+
+func (r *attachmentRepository) CompleteProcessing(ctx context.Context, attachment *models.Attachment) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(attachment).
+		Where("status = ?", models.AttachmentStatusProcessing).
+		Select(
+			"status", "scanned_at", "scan_signature", "size", "storage_key",
+			"width", "height", "duration_ms", "blurhash", "thumbnail_key",
+			"thumbnail_content_type", "thumbnail_width", "thumbnail_height", "processed_at",
+		).
+		Updates(attachment)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *attachmentRepository) FindUnsent(ctx context.Context, before time.Time, limit int) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	err := r.db.WithContext(ctx).
+		Where("message_id IS NULL AND status <> ? AND created_at < ?", models.AttachmentStatusProcessing, before).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&attachments).Error
+	return attachments, err
+}
+
+func (r *attachmentRepository) DeleteUnsent(ctx context.Context, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Where("id = ? AND message_id IS NULL", id).
+		Delete(&models.Attachment{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *attachmentRepository) UnsentUsage(ctx context.Context, uploaderID uuid.UUID) (UploadUsage, error) {
+	var usage UploadUsage
+	err := r.db.WithContext(ctx).
+		Model(&models.Attachment{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(size), 0) AS bytes").
+		Where("uploader_id = ? AND message_id IS NULL", uploaderID).
+		Scan(&usage).Error
+	return usage, err
+}
+
+type UploadSessionRepository interface {
+	Create(ctx context.Context, session *models.UploadSession) error
+	FindActiveByID(ctx context.Context, id uuid.UUID) (*models.UploadSession, error)
+	// Advance moves the offset forward, reporting false if it was no longer at from
+	Advance(ctx context.Context, id uuid.UUID, from, to int64) (bool, error)
+	SetContentType(ctx context.Context, id uuid.UUID, contentType string) error
+	Complete(ctx context.Context, id, attachmentID uuid.UUID) error
+	// InProgressUsage totals the uploader's sessions that are neither complete nor expired
+	InProgressUsage(ctx context.Context, uploaderID uuid.UUID) (UploadUsage, error)
+	FindExpired(ctx context.Context, limit int) ([]models.UploadSession, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+type uploadSessionRepository struct {
+	db *gorm.DB
+}
+
+func NewUploadSessionRepository(db *gorm.DB) UploadSessionRepository {
+	return &uploadSessionRepository{db: db}
+}
+
+func (r *uploadSessionRepository) Create(ctx context.Context, session *models.UploadSession) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+// FindActiveByID returns a session that hasn't expired; completed sessions are
+// still returned so a client can learn the attachment after a lost response
+func (r *uploadSessionRepository) FindActiveByID(ctx context.Context, id uuid.UUID) (*models.UploadSession, error) {
+	var session models.UploadSession
+	err := r.db.WithContext(ctx).
+		Where("id = ? AND expires_at > ?", id, time.Now()).
+		First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadSessionNotFound
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *uploadSessionRepository) Advance(ctx context.Context, id uuid.UUID, from, to int64) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.UploadSession{}).
+		Where("id = ? AND upload_offset = ? AND completed_at IS NULL", id, from).
+		Update("upload_offset", to)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *uploadSessionRepository) SetContentType(ctx context.Context, id uuid.UUID, contentType string) error {
+	return r.db.WithContext(ctx).
+		Model(&models.UploadSession{}).
+		Where("id = ?", id).
+		Update("content_type", contentType).Error
+}
+
+func (r *uploadSessionRepository) Complete(ctx context.Context, id, attachmentID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&models.UploadSession{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"attachment_id": attachmentID,
+			"completed_at":  time.Now(),
+		}).Error
+}
+
+func (r *uploadSessionRepository) InProgressUsage(ctx context.Context, uploaderID uuid.UUID) (UploadUsage, error) {
+	var usage UploadUsage
+	err := r.db.WithContext(ctx).
+		Model(&models.UploadSession{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(size), 0) AS bytes").
+		Where("uploader_id = ? AND completed_at IS NULL AND expires_at > ?", uploaderID, time.Now()).
+		Scan(&usage).Error
+	return usage, err
+}
+
+func (r *uploadSessionRepository) FindExpired(ctx context.Context, limit int) ([]models.UploadSession, error) {
+	var sessions []models.UploadSession
+	err := r.db.WithContext(ctx).
+		Where("expires_at <= ?", time.Now()).
+		Order("expires_at ASC").
+		Limit(limit).
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *uploadSessionRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Delete(&models.UploadSession{}, "id = ?", id).Error
+}
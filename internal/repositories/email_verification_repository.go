@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrVerificationTokenNotFound = errors.New("verification token not found or expired")
+
+type EmailVerificationRepository interface {
+	Create(ctx context.Context, token *models.EmailVerificationToken) error
+	FindValidByHash(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error)
+	MarkUsed(ctx context.Context, id uuid.UUID) (bool, error)
+	InvalidateByUserID(ctx context.Context, userID uuid.UUID) error
+}
+
+type emailVerificationRepository struct {
+	db *gorm.DB
+}
+
+func NewEmailVerificationRepository(db *gorm.DB) EmailVerificationRepository {
+	return &emailVerificationRepository{db: db}
+}
+
+func (r *emailVerificationRepository) Create(ctx context.Context, token *models.EmailVerificationToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+func (r *emailVerificationRepository) FindValidByHash(ctx context.Context, tokenHash string) (*models.EmailVerificationToken, error) {
+	var token models.EmailVerificationToken
+	err := r.db.WithContext(ctx).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now()).
+		First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVerificationTokenNotFound
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkUsed consumes a verification token, reporting false if it was already used
+func (r *emailVerificationRepository) MarkUsed(ctx context.Context, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.EmailVerificationToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// InvalidateByUserID consumes every outstanding verification token for the user
+func (r *emailVerificationRepository) InvalidateByUserID(ctx context.Context, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&models.EmailVerificationToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
@@ -0,0 +1,24 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"gorm.io/gorm"
+)
+
+type LoginFailureRepository interface {
+	Create(ctx context.Context, failure *models.LoginFailure) error
+}
+
+type loginFailureRepository struct {
+	db *gorm.DB
+}
+
+func NewLoginFailureRepository(db *gorm.DB) LoginFailureRepository {
+	return &loginFailureRepository{db: db}
+}
+
+func (r *loginFailureRepository) Create(ctx context.Context, failure *models.LoginFailure) error {
+	return r.db.WithContext(ctx).Create(failure).Error
+}
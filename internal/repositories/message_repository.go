@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/kevinsofyan/echoes-chat-api/internal/models"
@@ -10,12 +11,49 @@ import (
 
 type MessageRepository interface {
 	Create(ctx context.Context, message *models.Message) error
+	// CreateWithAttachments creates a message and links the sender's unsent
+	// attachments to it in one transaction. Nothing is saved, and
+	// ErrAttachmentUnavailable is returned, unless every attachment is linked.
+	CreateWithAttachments(ctx context.Context, message *models.Message, attachmentIDs []uuid.UUID) error
 	FindByID(ctx context.Context, id uuid.UUID) (*models.Message, error)
-	FindByRoomID(ctx context.Context, roomID uuid.UUID, limit, offset int) ([]models.Message, error)
+	FindByRoomID(ctx context.Context, roomID uuid.UUID, query MessageQuery) ([]models.Message, error)
 	Update(ctx context.Context, message *models.Message) error
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
+// MessageCursor identifies a position in a room's timeline.
+// The ID breaks ties between messages created in the same instant.
+type MessageCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// MessageQuery selects a page of a room's messages by keyset rather than offset.
+// With neither Before nor After set, the newest messages are returned.
+type MessageQuery struct {
+	Before    *MessageCursor
+	After     *MessageCursor
+	Inclusive bool // include the message at the cursor itself
+	Limit     int
+	// ViewerID still sees their own messages that are withheld until their
+	// attachments are cleared; everyone else's are left out
+	ViewerID uuid.UUID
+}
+
+// unclearedAttachmentStatuses are those that withhold a message, as in models.Message.IsWithheld
+var unclearedAttachmentStatuses = []string{
+	string(models.AttachmentStatusProcessing),
+	string(models.AttachmentStatusQuarantined),
+}
+
+// visibleToViewer is a condition on the messages aliased as table, with the
+// viewer ID and unclearedAttachmentStatuses as its arguments. It keeps messages
+// withheld for attachment scanning from everyone but their sender.
+func visibleToViewer(table string) string {
+	return "(" + table + ".sender_id = ? OR NOT EXISTS (SELECT 1 FROM attachments WHERE attachments.message_id = " + table +
+		".id AND attachments.status IN ? AND attachments.deleted_at IS NULL))"
+}
+
 type messageRepository struct {
 	db *gorm.DB
 }
@@ -28,11 +66,32 @@ func (r *messageRepository) Create(ctx context.Context, message *models.Message)
 	return r.db.WithContext(ctx).Create(message).Error
 }
 
+func (r *messageRepository) CreateWithAttachments(ctx context.Context, message *models.Message, attachmentIDs []uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(message).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.Attachment{}).
+			Where("id IN ? AND uploader_id = ? AND message_id IS NULL", attachmentIDs, message.SenderID).
+			Update("message_id", message.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		// Another message claimed one of the attachments first
+		if result.RowsAffected != int64(len(attachmentIDs)) {
+			return ErrAttachmentUnavailable
+		}
+		return nil
+	})
+}
+
 func (r *messageRepository) FindByID(ctx context.Context, id uuid.UUID) (*models.Message, error) {
 	var message models.Message
 	err := r.db.WithContext(ctx).
 		Preload("Sender").
-		Preload("ReplyTo").
+		Preload("ReplyTo.Attachments").
+		Preload("Attachments").
 		First(&message, "id = ?", id).Error
 	if err != nil {
 		return nil, err
@@ -40,23 +99,52 @@ func (r *messageRepository) FindByID(ctx context.Context, id uuid.UUID) (*models
 	return &message, nil
 }
 
-func (r *messageRepository) FindByRoomID(ctx context.Context, roomID uuid.UUID, limit, offset int) ([]models.Message, error) {
+// FindByRoomID returns messages newest first. It relies on the
+// (room_id, created_at, id) index so pages stay fast deep into large rooms.
+func (r *messageRepository) FindByRoomID(ctx context.Context, roomID uuid.UUID, q MessageQuery) ([]models.Message, error) {
 	var messages []models.Message
 	query := r.db.WithContext(ctx).
 		Where("room_id = ?", roomID).
 		Preload("Sender").
-		Preload("ReplyTo").
-		Order("created_at DESC")
+		Preload("ReplyTo.Attachments").
+		Preload("Attachments").
+		Where(visibleToViewer("messages"), q.ViewerID, unclearedAttachmentStatuses)
+
+	if q.After != nil {
+		op := ">"
+		if q.Inclusive {
+			op = ">="
+		}
+		// Walk forward from the cursor so the limit keeps the messages closest to it
+		query = query.
+			Where("(created_at, id) "+op+" (?, ?)", q.After.CreatedAt, q.After.ID).
+			Order("created_at ASC, id ASC")
+	} else {
+		if q.Before != nil {
+			op := "<"
+			if q.Inclusive {
+				op = "<="
+			}
+			query = query.Where("(created_at, id) "+op+" (?, ?)", q.Before.CreatedAt, q.Before.ID)
+		}
+		query = query.Order("created_at DESC, id DESC")
+	}
 
-	if limit > 0 {
-		query = query.Limit(limit)
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
 	}
-	if offset > 0 {
-		query = query.Offset(offset)
+
+	if err := query.Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	if q.After != nil {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
 	}
 
-	err := query.Find(&messages).Error
-	return messages, err
+	return messages, nil
 }
 
 func (r *messageRepository) Update(ctx context.Context, message *models.Message) error {
@@ -64,5 +152,5 @@ func (r *messageRepository) Update(ctx context.Context, message *models.Message)
 }
 
 func (r *messageRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&models.Message{}, id).Error
+	return r.db.WithContext(ctx).Where("id = ?", id).Delete(&models.Message{}).Error
 }
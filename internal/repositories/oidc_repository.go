@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIdentityNotFound   = errors.New("OIDC identity not found")
+	ErrLoginStateNotFound = errors.New("OIDC login state not found or expired")
+)
+
+type OIDCIdentityRepository interface {
+	Create(ctx context.Context, identity *models.OIDCIdentity) error
+	FindBySubject(ctx context.Context, provider, subject string) (*models.OIDCIdentity, error)
+	FindByUserID(ctx context.Context, provider string, userID uuid.UUID) (*models.OIDCIdentity, error)
+}
+
+type oidcIdentityRepository struct {
+	db *gorm.DB
+}
+
+func NewOIDCIdentityRepository(db *gorm.DB) OIDCIdentityRepository {
+	return &oidcIdentityRepository{db: db}
+}
+
+func (r *oidcIdentityRepository) Create(ctx context.Context, identity *models.OIDCIdentity) error {
+	return r.db.WithContext(ctx).Create(identity).Error
+}
+
+func (r *oidcIdentityRepository) FindBySubject(ctx context.Context, provider, subject string) (*models.OIDCIdentity, error) {
+	return r.findWhere(ctx, "provider = ? AND subject = ?", provider, subject)
+}
+
+func (r *oidcIdentityRepository) FindByUserID(ctx context.Context, provider string, userID uuid.UUID) (*models.OIDCIdentity, error) {
+	return r.findWhere(ctx, "provider = ? AND user_id = ?", provider, userID)
+}
+
+func (r *oidcIdentityRepository) findWhere(ctx context.Context, query string, args ...interface{}) (*models.OIDCIdentity, error) {
+	var identity models.OIDCIdentity
+	err := r.db.WithContext(ctx).Where(query, args...).First(&identity).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrIdentityNotFound
+		}
+		return nil, err
+	}
+	return &identity, nil
+}
+
+type OIDCLoginStateRepository interface {
+	Create(ctx context.Context, state *models.OIDCLoginState) error
+	FindValidByHash(ctx context.Context, provider, stateHash string) (*models.OIDCLoginState, error)
+	MarkUsed(ctx context.Context, id uuid.UUID) (bool, error)
+}
+
+type oidcLoginStateRepository struct {
+	db *gorm.DB
+}
+
+func NewOIDCLoginStateRepository(db *gorm.DB) OIDCLoginStateRepository {
+	return &oidcLoginStateRepository{db: db}
+}
+
+func (r *oidcLoginStateRepository) Create(ctx context.Context, state *models.OIDCLoginState) error {
+	return r.db.WithContext(ctx).Create(state).Error
+}
+
+func (r *oidcLoginStateRepository) FindValidByHash(ctx context.Context, provider, stateHash string) (*models.OIDCLoginState, error) {
+	var state models.OIDCLoginState
+	err := r.db.WithContext(ctx).
+		Where("provider = ? AND state_hash = ? AND used_at IS NULL AND expires_at > ?", provider, stateHash, time.Now()).
+		First(&state).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLoginStateNotFound
+		}
+		return nil, err
+	}
+	return &state, nil
+}
+
+// MarkUsed consumes a state, reporting false if the callback already used it
+func (r *oidcLoginStateRepository) MarkUsed(ctx context.Context, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.OIDCLoginState{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
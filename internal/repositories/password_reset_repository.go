@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrResetTokenNotFound = errors.New("reset token not found or expired")
+
+type PasswordResetRepository interface {
+	Create(ctx context.Context, token *models.PasswordResetToken) error
+	FindValidByHash(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error)
+	MarkUsed(ctx context.Context, id uuid.UUID) (bool, error)
+	InvalidateByUserID(ctx context.Context, userID uuid.UUID) error
+}
+
+type passwordResetRepository struct {
+	db *gorm.DB
+}
+
+func NewPasswordResetRepository(db *gorm.DB) PasswordResetRepository {
+	return &passwordResetRepository{db: db}
+}
+
+func (r *passwordResetRepository) Create(ctx context.Context, token *models.PasswordResetToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+func (r *passwordResetRepository) FindValidByHash(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	err := r.db.WithContext(ctx).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now()).
+		First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrResetTokenNotFound
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkUsed consumes a reset token, reporting false if it was already used
+func (r *passwordResetRepository) MarkUsed(ctx context.Context, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// InvalidateByUserID consumes every outstanding reset token for the user
+func (r *passwordResetRepository) InvalidateByUserID(ctx context.Context, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
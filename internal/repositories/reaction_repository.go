@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ReactionRepository interface {
+	// Add reports whether the reaction was new
+	Add(ctx context.Context, reaction *models.MessageReaction) (bool, error)
+	Exists(ctx context.Context, messageID, userID uuid.UUID, emoji string) (bool, error)
+	Remove(ctx context.Context, messageID, userID uuid.UUID, emoji string) (bool, error)
+	CountByEmoji(ctx context.Context, messageID uuid.UUID, emoji string) (int64, error)
+	CountByUser(ctx context.Context, messageID, userID uuid.UUID) (int64, error)
+	CountByMessageIDs(ctx context.Context, messageIDs []uuid.UUID, viewerID uuid.UUID) ([]models.ReactionCount, error)
+}
+
+type reactionRepository struct {
+	db *gorm.DB
+}
+
+func NewReactionRepository(db *gorm.DB) ReactionRepository {
+	return &reactionRepository{db: db}
+}
+
+// Add records the reaction, doing nothing if the user already reacted with that emoji
+func (r *reactionRepository) Add(ctx context.Context, reaction *models.MessageReaction) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "message_id"}, {Name: "user_id"}, {Name: "emoji"}},
+			DoNothing: true,
+		}).
+		Create(reaction)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *reactionRepository) Exists(ctx context.Context, messageID, userID uuid.UUID, emoji string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.MessageReaction{}).
+		Where("message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji).
+		Limit(1).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Remove deletes the user's reaction, reporting whether there was one
+func (r *reactionRepository) Remove(ctx context.Context, messageID, userID uuid.UUID, emoji string) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Where("message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji).
+		Delete(&models.MessageReaction{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *reactionRepository) CountByEmoji(ctx context.Context, messageID uuid.UUID, emoji string) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.MessageReaction{}).
+		Where("message_id = ? AND emoji = ?", messageID, emoji).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *reactionRepository) CountByUser(ctx context.Context, messageID, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&models.MessageReaction{}).
+		Where("message_id = ? AND user_id = ?", messageID, userID).
+		Count(&count).Error
+	return count, err
+}
+
+// CountByMessageIDs totals the reactions on each message per emoji, noting
+// which ones the viewer made. Emoji are ordered by when they were first used.
+func (r *reactionRepository) CountByMessageIDs(ctx context.Context, messageIDs []uuid.UUID, viewerID uuid.UUID) ([]models.ReactionCount, error) {
+	var counts []models.ReactionCount
+	if len(messageIDs) == 0 {
+		return counts, nil
+	}
+
+	err := r.db.WithContext(ctx).
+		Model(&models.MessageReaction{}).
+		Select("message_id, emoji, COUNT(*) AS count, BOOL_OR(user_id = ?) AS reacted", viewerID).
+		Where("message_id IN ?", messageIDs).
+		Group("message_id, emoji").
+		Order("MIN(created_at), emoji").
+		Scan(&counts).Error
+	return counts, err
+}
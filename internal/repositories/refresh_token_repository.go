@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *models.RefreshToken) error
+	FindByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	FindByFamilyID(ctx context.Context, familyID uuid.UUID) ([]models.RefreshToken, error)
+	MarkUsed(ctx context.Context, id uuid.UUID) (bool, error)
+	SetReplacedBy(ctx context.Context, id, replacedByID uuid.UUID) error
+	RevokeFamily(ctx context.Context, familyID uuid.UUID) error
+	RevokeByUserID(ctx context.Context, userID uuid.UUID) error
+	DeleteExpired(ctx context.Context) error
+}
+
+type refreshTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewRefreshTokenRepository(db *gorm.DB) RefreshTokenRepository {
+	return &refreshTokenRepository{db: db}
+}
+
+func (r *refreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+func (r *refreshTokenRepository) FindByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *refreshTokenRepository) FindByFamilyID(ctx context.Context, familyID uuid.UUID) ([]models.RefreshToken, error) {
+	var tokens []models.RefreshToken
+	err := r.db.WithContext(ctx).
+		Where("family_id = ?", familyID).
+		Order("created_at ASC").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+// MarkUsed consumes a refresh token. It reports false if the token was already
+// used, so two concurrent refreshes can't both succeed.
+func (r *refreshTokenRepository) MarkUsed(ctx context.Context, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *refreshTokenRepository) SetReplacedBy(ctx context.Context, id, replacedByID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&models.RefreshToken{}).
+		Where("id = ?", id).
+		Update("replaced_by_id", replacedByID).Error
+}
+
+func (r *refreshTokenRepository) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *refreshTokenRepository) RevokeByUserID(ctx context.Context, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *refreshTokenRepository) DeleteExpired(ctx context.Context) error {
+	return r.db.WithContext(ctx).
+		Where("expires_at <= ?", time.Now()).
+		Delete(&models.RefreshToken{}).Error
+}
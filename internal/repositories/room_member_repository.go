@@ -0,0 +1,88 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrMemberNotFound = errors.New("member not found")
+
+type RoomMemberRepository interface {
+	Create(ctx context.Context, member *models.RoomMember) error
+	FindByRoomAndUser(ctx context.Context, roomID, userID uuid.UUID) (*models.RoomMember, error)
+	FindByRoomID(ctx context.Context, roomID uuid.UUID) ([]models.RoomMember, error)
+	UpdateRole(ctx context.Context, roomID, userID uuid.UUID, role models.RoomMemberRole) error
+	Delete(ctx context.Context, roomID, userID uuid.UUID) error
+	TransferOwnership(ctx context.Context, roomID, fromUserID, toUserID uuid.UUID) error
+}
+
+type roomMemberRepository struct {
+	db *gorm.DB
+}
+
+func NewRoomMemberRepository(db *gorm.DB) RoomMemberRepository {
+	return &roomMemberRepository{db: db}
+}
+
+func (r *roomMemberRepository) Create(ctx context.Context, member *models.RoomMember) error {
+	return r.db.WithContext(ctx).Create(member).Error
+}
+
+func (r *roomMemberRepository) FindByRoomAndUser(ctx context.Context, roomID, userID uuid.UUID) (*models.RoomMember, error) {
+	var member models.RoomMember
+	err := r.db.WithContext(ctx).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		First(&member).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMemberNotFound
+		}
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *roomMemberRepository) FindByRoomID(ctx context.Context, roomID uuid.UUID) ([]models.RoomMember, error) {
+	var members []models.RoomMember
+	err := r.db.WithContext(ctx).
+		Where("room_id = ?", roomID).
+		Preload("User").
+		Order("joined_at ASC").
+		Find(&members).Error
+	return members, err
+}
+
+func (r *roomMemberRepository) UpdateRole(ctx context.Context, roomID, userID uuid.UUID, role models.RoomMemberRole) error {
+	return r.db.WithContext(ctx).
+		Model(&models.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Update("role", role).Error
+}
+
+// Delete removes the membership row permanently so the user can be re-added
+// later without tripping the (room_id, user_id) unique constraint.
+func (r *roomMemberRepository) Delete(ctx context.Context, roomID, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Unscoped().
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Delete(&models.RoomMember{}).Error
+}
+
+// TransferOwnership demotes the current owner to admin and promotes the new owner atomically
+func (r *roomMemberRepository) TransferOwnership(ctx context.Context, roomID, fromUserID, toUserID uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RoomMember{}).
+			Where("room_id = ? AND user_id = ?", roomID, fromUserID).
+			Update("role", models.RoleAdmin).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.RoomMember{}).
+			Where("room_id = ? AND user_id = ?", roomID, toUserID).
+			Update("role", models.RoleOwner).Error
+	})
+}
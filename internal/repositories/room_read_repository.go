@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RoomReadRepository interface {
+	Upsert(ctx context.Context, read *models.RoomRead) error
+	FindByRoomAndUser(ctx context.Context, roomID, userID uuid.UUID) (*models.RoomRead, error)
+}
+
+type roomReadRepository struct {
+	db *gorm.DB
+}
+
+func NewRoomReadRepository(db *gorm.DB) RoomReadRepository {
+	return &roomReadRepository{db: db}
+}
+
+// Upsert records the read position, never moving it backwards
+// if an older acknowledgement arrives after a newer one.
+func (r *roomReadRepository) Upsert(ctx context.Context, read *models.RoomRead) error {
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "room_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"last_read_message_id", "last_read_at", "updated_at"}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Expr{SQL: "room_reads.last_read_at < EXCLUDED.last_read_at"},
+			}},
+		}).
+		Create(read).Error
+}
+
+func (r *roomReadRepository) FindByRoomAndUser(ctx context.Context, roomID, userID uuid.UUID) (*models.RoomRead, error) {
+	var read models.RoomRead
+	err := r.db.WithContext(ctx).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		First(&read).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("read receipt not found")
+		}
+		return nil, err
+	}
+	return &read, nil
+}
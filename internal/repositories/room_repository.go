@@ -2,16 +2,22 @@ package repositories
 
 import (
 	"context"
+	"errors"
+	"sort"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/kevinsofyan/echoes-chat-api/internal/models"
 	"gorm.io/gorm"
 )
 
+var ErrRoomNotFound = errors.New("room not found")
+
 type RoomRepository interface {
 	Create(ctx context.Context, room *models.Room) error
 	FindByID(ctx context.Context, id uuid.UUID) (*models.Room, error)
-	FindByUserID(ctx context.Context, userID uuid.UUID) ([]models.Room, error)
+	FindByUserID(ctx context.Context, userID uuid.UUID) ([]models.RoomSummary, error)
+	FindIDsByUserID(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
 	Update(ctx context.Context, room *models.Room) error
 	Delete(ctx context.Context, id uuid.UUID) error
 }
@@ -35,12 +41,18 @@ func (r *roomRepository) FindByID(ctx context.Context, id uuid.UUID) (*models.Ro
 		Preload("Members").
 		First(&room, "id = ?", id).Error
 	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoomNotFound
+		}
 		return nil, err
 	}
 	return &room, nil
 }
 
-func (r *roomRepository) FindByUserID(ctx context.Context, userID uuid.UUID) ([]models.Room, error) {
+// FindByUserID lists the user's rooms with their unread count and latest message,
+// most recently active first. Counts and latest messages are fetched in one
+// query each rather than per room.
+func (r *roomRepository) FindByUserID(ctx context.Context, userID uuid.UUID) ([]models.RoomSummary, error) {
 	var rooms []models.Room
 	err := r.db.WithContext(ctx).
 		Joins("JOIN room_members ON room_members.room_id = rooms.id").
@@ -48,7 +60,90 @@ func (r *roomRepository) FindByUserID(ctx context.Context, userID uuid.UUID) ([]
 		Preload("Creator").
 		Preload("Members").
 		Find(&rooms).Error
-	return rooms, err
+	if err != nil || len(rooms) == 0 {
+		return []models.RoomSummary{}, err
+	}
+
+	roomIDs := make([]uuid.UUID, len(rooms))
+	for i, room := range rooms {
+		roomIDs[i] = room.ID
+	}
+
+	// Messages are unread if they're newer than the user's read position, or than
+	// when they joined if they haven't read anything yet. Their own messages never
+	// count, nor do messages withheld for attachment scanning.
+	var counts []struct {
+		RoomID      uuid.UUID
+		UnreadCount int64
+	}
+	err = r.db.WithContext(ctx).Raw(`
+		SELECT m.room_id, COUNT(*) AS unread_count
+		FROM messages m
+		JOIN room_members rm ON rm.room_id = m.room_id AND rm.user_id = ?
+		LEFT JOIN room_reads rr ON rr.room_id = m.room_id AND rr.user_id = rm.user_id
+		WHERE m.deleted_at IS NULL
+			AND m.sender_id <> rm.user_id
+			AND m.created_at > COALESCE(rr.last_read_at, rm.joined_at)
+			AND `+visibleToViewer("m")+`
+		GROUP BY m.room_id`, userID, userID, unclearedAttachmentStatuses).
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// A lateral subquery per room reads just the newest entry of the
+	// (room_id, created_at, id) index, rather than sorting each room's history
+	var lastMessages []models.Message
+	err = r.db.WithContext(ctx).
+		Table("rooms").
+		Select("last_message.*").
+		Joins(`CROSS JOIN LATERAL (
+			SELECT * FROM messages
+			WHERE messages.room_id = rooms.id
+				AND messages.deleted_at IS NULL
+				AND `+visibleToViewer("messages")+`
+			ORDER BY messages.created_at DESC, messages.id DESC
+			LIMIT 1
+		) AS last_message`, userID, unclearedAttachmentStatuses).
+		Where("rooms.id IN ?", roomIDs).
+		Preload("Sender").
+		Find(&lastMessages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	unread := make(map[uuid.UUID]int64, len(counts))
+	for _, c := range counts {
+		unread[c.RoomID] = c.UnreadCount
+	}
+	latest := make(map[uuid.UUID]*models.Message, len(lastMessages))
+	for i := range lastMessages {
+		latest[lastMessages[i].RoomID] = &lastMessages[i]
+	}
+
+	summaries := make([]models.RoomSummary, len(rooms))
+	for i, room := range rooms {
+		summaries[i] = models.RoomSummary{
+			Room:        room,
+			UnreadCount: unread[room.ID],
+			LastMessage: latest[room.ID],
+		}
+	}
+
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return lastActivity(summaries[i]).After(lastActivity(summaries[j]))
+	})
+
+	return summaries, nil
+}
+
+func (r *roomRepository) FindIDsByUserID(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	var roomIDs []uuid.UUID
+	err := r.db.WithContext(ctx).
+		Model(&models.RoomMember{}).
+		Where("user_id = ?", userID).
+		Pluck("room_id", &roomIDs).Error
+	return roomIDs, err
 }
 
 func (r *roomRepository) Update(ctx context.Context, room *models.Room) error {
@@ -58,3 +153,10 @@ func (r *roomRepository) Update(ctx context.Context, room *models.Room) error {
 func (r *roomRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	return r.db.WithContext(ctx).Delete(&models.Room{}, id).Error
 }
+
+func lastActivity(summary models.RoomSummary) time.Time {
+	if summary.LastMessage != nil {
+		return summary.LastMessage.CreatedAt
+	}
+	return summary.CreatedAt
+}
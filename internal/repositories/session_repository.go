@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *models.Session) error
+	FindActiveByID(ctx context.Context, id uuid.UUID) (*models.Session, error)
+	FindActiveByUserID(ctx context.Context, userID uuid.UUID) ([]models.Session, error)
+	Touch(ctx context.Context, id uuid.UUID, userAgent, ipAddress string) error
+	Revoke(ctx context.Context, id uuid.UUID) error
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) Create(ctx context.Context, session *models.Session) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+func (r *sessionRepository) FindActiveByID(ctx context.Context, id uuid.UUID) (*models.Session, error) {
+	var session models.Session
+	err := r.db.WithContext(ctx).
+		Where("id = ? AND revoked_at IS NULL", id).
+		First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) FindActiveByUserID(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Touch records that the session was just used, from the given device
+func (r *sessionRepository) Touch(ctx context.Context, id uuid.UUID, userAgent, ipAddress string) error {
+	return r.db.WithContext(ctx).
+		Model(&models.Session{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"user_agent":   userAgent,
+			"ip_address":   ipAddress,
+			"last_used_at": time.Now(),
+		}).Error
+}
+
+func (r *sessionRepository) Revoke(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
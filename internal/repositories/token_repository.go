@@ -10,12 +10,18 @@ import (
 	"gorm.io/gorm"
 )
 
+var ErrTokenNotFound = errors.New("token not found or expired")
+
 type TokenRepository interface {
 	Create(ctx context.Context, token *models.Token) error
 	FindByToken(ctx context.Context, tokenString string) (*models.Token, error)
+	FindByJTI(ctx context.Context, jti uuid.UUID) (*models.Token, error)
 	FindByUserID(ctx context.Context, userID uuid.UUID) ([]models.Token, error)
+	FindBySessionID(ctx context.Context, sessionID uuid.UUID) ([]models.Token, error)
 	Delete(ctx context.Context, tokenString string) error
+	DeleteByJTI(ctx context.Context, jti uuid.UUID) error
 	DeleteByUserID(ctx context.Context, userID uuid.UUID) error
+	DeleteBySessionID(ctx context.Context, sessionID uuid.UUID) error
 	DeleteExpired(ctx context.Context) error
 }
 
@@ -39,7 +45,23 @@ func (r *tokenRepository) FindByToken(ctx context.Context, tokenString string) (
 
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("token not found or expired")
+			return nil, ErrTokenNotFound
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (r *tokenRepository) FindByJTI(ctx context.Context, jti uuid.UUID) (*models.Token, error) {
+	var token models.Token
+	err := r.db.WithContext(ctx).
+		Where("jti = ? AND expires_at > ?", jti, time.Now()).
+		First(&token).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTokenNotFound
 		}
 		return nil, err
 	}
@@ -56,18 +78,39 @@ func (r *tokenRepository) FindByUserID(ctx context.Context, userID uuid.UUID) ([
 	return tokens, err
 }
 
+func (r *tokenRepository) FindBySessionID(ctx context.Context, sessionID uuid.UUID) ([]models.Token, error) {
+	var tokens []models.Token
+	err := r.db.WithContext(ctx).
+		Where("session_id = ? AND expires_at > ?", sessionID, time.Now()).
+		Find(&tokens).Error
+
+	return tokens, err
+}
+
 func (r *tokenRepository) Delete(ctx context.Context, tokenString string) error {
 	return r.db.WithContext(ctx).
 		Where("token = ?", tokenString).
 		Delete(&models.Token{}).Error
 }
 
+func (r *tokenRepository) DeleteByJTI(ctx context.Context, jti uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Where("jti = ?", jti).
+		Delete(&models.Token{}).Error
+}
+
 func (r *tokenRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
 	return r.db.WithContext(ctx).
 		Where("user_id = ?", userID).
 		Delete(&models.Token{}).Error
 }
 
+func (r *tokenRepository) DeleteBySessionID(ctx context.Context, sessionID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Where("session_id = ?", sessionID).
+		Delete(&models.Token{}).Error
+}
+
 func (r *tokenRepository) DeleteExpired(ctx context.Context) error {
 	return r.db.WithContext(ctx).
 		Where("expires_at <= ?", time.Now()).
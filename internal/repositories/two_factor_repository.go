@@ -0,0 +1,107 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrChallengeNotFound = errors.New("two-factor challenge not found or expired")
+
+type RecoveryCodeRepository interface {
+	// Replace discards the user's codes and stores new ones
+	Replace(ctx context.Context, userID uuid.UUID, codes []models.RecoveryCode) error
+	Consume(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error)
+	DeleteByUserID(ctx context.Context, userID uuid.UUID) error
+}
+
+type recoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewRecoveryCodeRepository(db *gorm.DB) RecoveryCodeRepository {
+	return &recoveryCodeRepository{db: db}
+}
+
+func (r *recoveryCodeRepository) Replace(ctx context.Context, userID uuid.UUID, codes []models.RecoveryCode) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// Consume marks an unused code as used, reporting false if there was none
+func (r *recoveryCodeRepository) Consume(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *recoveryCodeRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Delete(&models.RecoveryCode{}).Error
+}
+
+type TwoFactorChallengeRepository interface {
+	Create(ctx context.Context, challenge *models.TwoFactorChallenge) error
+	FindValidByHash(ctx context.Context, tokenHash string) (*models.TwoFactorChallenge, error)
+	IncrementAttempts(ctx context.Context, id uuid.UUID) error
+	MarkUsed(ctx context.Context, id uuid.UUID) (bool, error)
+}
+
+type twoFactorChallengeRepository struct {
+	db *gorm.DB
+}
+
+func NewTwoFactorChallengeRepository(db *gorm.DB) TwoFactorChallengeRepository {
+	return &twoFactorChallengeRepository{db: db}
+}
+
+func (r *twoFactorChallengeRepository) Create(ctx context.Context, challenge *models.TwoFactorChallenge) error {
+	return r.db.WithContext(ctx).Create(challenge).Error
+}
+
+func (r *twoFactorChallengeRepository) FindValidByHash(ctx context.Context, tokenHash string) (*models.TwoFactorChallenge, error) {
+	var challenge models.TwoFactorChallenge
+	err := r.db.WithContext(ctx).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now()).
+		First(&challenge).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrChallengeNotFound
+		}
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+func (r *twoFactorChallengeRepository) IncrementAttempts(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&models.TwoFactorChallenge{}).
+		Where("id = ?", id).
+		Update("attempts", gorm.Expr("attempts + 1")).Error
+}
+
+// MarkUsed consumes a challenge, reporting false if it was already used
+func (r *twoFactorChallengeRepository) MarkUsed(ctx context.Context, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&models.TwoFactorChallenge{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
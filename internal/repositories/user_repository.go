@@ -3,12 +3,15 @@ package repositories
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/kevinsofyan/echoes-chat-api/internal/models"
 	"gorm.io/gorm"
 )
 
+var ErrUserNotFound = errors.New("user not found")
+
 type UserRepository interface {
 	Create(ctx context.Context, user *models.User) error
 	FindByID(ctx context.Context, id uuid.UUID) (*models.User, error)
@@ -18,6 +21,15 @@ type UserRepository interface {
 	Delete(ctx context.Context, id uuid.UUID) error
 	GetAll(ctx context.Context, limit, offset int) ([]models.User, error)
 	UpdateOnlineStatus(ctx context.Context, id uuid.UUID, isOnline bool) error
+	UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error
+	MarkEmailVerified(ctx context.Context, id uuid.UUID) error
+	SetTwoFactorSecret(ctx context.Context, id uuid.UUID, secret string) error
+	// ReplaceTwoFactorSecret swaps the stored secret for an equivalent one,
+	// such as its sealed form, unless it changed in the meantime
+	ReplaceTwoFactorSecret(ctx context.Context, id uuid.UUID, old, secret string) error
+	EnableTwoFactor(ctx context.Context, id uuid.UUID) error
+	DisableTwoFactor(ctx context.Context, id uuid.UUID) error
+	ClaimTwoFactorStep(ctx context.Context, id uuid.UUID, step int64) (bool, error)
 }
 
 type userRepository struct {
@@ -37,7 +49,7 @@ func (r *userRepository) FindByID(ctx context.Context, id uuid.UUID) (*models.Us
 	err := r.db.WithContext(ctx).Where("id = ?", id).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -49,7 +61,7 @@ func (r *userRepository) FindByEmail(ctx context.Context, email string) (*models
 	err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -61,7 +73,7 @@ func (r *userRepository) FindByUsername(ctx context.Context, username string) (*
 	err := r.db.WithContext(ctx).Where("username = ?", username).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -82,6 +94,59 @@ func (r *userRepository) GetAll(ctx context.Context, limit, offset int) ([]model
 	return users, err
 }
 
+// UpdateOnlineStatus also stamps last_seen, so after going offline it holds the disconnect time
 func (r *userRepository) UpdateOnlineStatus(ctx context.Context, id uuid.UUID, isOnline bool) error {
-	return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Update("is_online", isOnline).Error
+	return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"is_online": isOnline,
+		"last_seen": time.Now(),
+	}).Error
+}
+
+func (r *userRepository) UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
+	return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Update("password", passwordHash).Error
+}
+
+func (r *userRepository) MarkEmailVerified(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND email_verified_at IS NULL", id).
+		Update("email_verified_at", time.Now()).Error
+}
+
+// SetTwoFactorSecret stores a pending secret; it has no effect on login until enabled
+func (r *userRepository) SetTwoFactorSecret(ctx context.Context, id uuid.UUID, secret string) error {
+	return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"two_factor_secret":     secret,
+		"two_factor_enabled_at": nil,
+		"two_factor_last_step":  nil,
+	}).Error
+}
+
+func (r *userRepository) ReplaceTwoFactorSecret(ctx context.Context, id uuid.UUID, old, secret string) error {
+	return r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND two_factor_secret = ?", id, old).
+		Update("two_factor_secret", secret).Error
+}
+
+func (r *userRepository) EnableTwoFactor(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Update("two_factor_enabled_at", time.Now()).Error
+}
+
+func (r *userRepository) DisableTwoFactor(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"two_factor_secret":     nil,
+		"two_factor_enabled_at": nil,
+		"two_factor_last_step":  nil,
+	}).Error
+}
+
+// ClaimTwoFactorStep records the time step of an accepted TOTP code. It reports
+// false if that step or a later one was already used, so a code can't be replayed.
+func (r *userRepository) ClaimTwoFactorStep(ctx context.Context, id uuid.UUID, step int64) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND (two_factor_last_step IS NULL OR two_factor_last_step < ?)", id, step).
+		Update("two_factor_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
 }
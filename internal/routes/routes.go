@@ -1,49 +1,46 @@
 package routes
 
 import (
-	"log"
-	"os"
-
-	"github.com/golang-jwt/jwt/v5"
 	_ "github.com/kevinsofyan/echoes-chat-api/docs"
 	"github.com/kevinsofyan/echoes-chat-api/internal/handlers"
-	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	echoSwagger "github.com/swaggo/echo-swagger"
 )
 
 type Handlers struct {
-	AuthHandler      *handlers.AuthHandler
-	UserHandler      *handlers.UserHandler
-	WebSocketHandler *handlers.WebSocketHandler
-	RoomHandler      *handlers.RoomHandler
+	AuthHandler       *handlers.AuthHandler
+	PasswordHandler   *handlers.PasswordHandler
+	VerifyHandler     *handlers.EmailVerificationHandler
+	TwoFactorHandler  *handlers.TwoFactorHandler
+	OIDCHandler       *handlers.OIDCHandler
+	JWKSHandler       *handlers.JWKSHandler
+	UserHandler       *handlers.UserHandler
+	WebSocketHandler  *handlers.WebSocketHandler
+	RoomHandler       *handlers.RoomHandler
+	MessageHandler    *handlers.MessageHandler
+	UploadHandler     *handlers.UploadHandler
+	AttachmentHandler *handlers.AttachmentHandler
+}
+
+type Middlewares struct {
+	// Authenticate verifies the access token and stores the caller's principal
+	Authenticate echo.MiddlewareFunc
+	// AuthenticateUnlessSigned lets signed links through for the handler to verify
+	AuthenticateUnlessSigned echo.MiddlewareFunc
+	// RequireVerifiedEmail guards actions unverified accounts can't take
+	RequireVerifiedEmail echo.MiddlewareFunc
 }
 
-func SetupRoutes(e *echo.Echo, h *Handlers) {
+func SetupRoutes(e *echo.Echo, h *Handlers, m *Middlewares) {
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	log.Printf("JWT_SECRET loaded: %d characters", len(jwtSecret))
-
-	jwtConfig := echojwt.Config{
-		SigningKey: []byte(jwtSecret),
-		NewClaimsFunc: func(c echo.Context) jwt.Claims {
-			return jwt.MapClaims{}
-		},
-		ErrorHandler: func(c echo.Context, err error) error {
-			log.Printf("JWT Middleware Error: %v", err)
-			log.Printf("Authorization Header: %s", c.Request().Header.Get("Authorization"))
-			return echo.NewHTTPError(401, map[string]interface{}{
-				"error":   "Invalid or expired token",
-				"details": err.Error(),
-			})
-		},
-	}
+	authenticated := []echo.MiddlewareFunc{m.Authenticate}
 
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
+	e.GET("/.well-known/jwks.json", h.JWKSHandler.GetJWKS)
 
 	api := e.Group("/api/v1")
 
@@ -58,11 +55,38 @@ func SetupRoutes(e *echo.Echo, h *Handlers) {
 	{
 		auth.POST("/register", h.AuthHandler.Register)
 		auth.POST("/login", h.AuthHandler.Login)
-		auth.POST("/logout", h.AuthHandler.Logout, echojwt.WithConfig(jwtConfig))
+		auth.POST("/refresh", h.AuthHandler.Refresh)
+		auth.POST("/logout", h.AuthHandler.Logout, authenticated...)
+
+		// Signed-in devices
+		auth.GET("/sessions", h.AuthHandler.GetSessions, authenticated...)
+		auth.DELETE("/sessions", h.AuthHandler.RevokeOtherSessions, authenticated...)
+		auth.DELETE("/sessions/:id", h.AuthHandler.RevokeSession, authenticated...)
+
+		// Passwords
+		auth.POST("/password/change", h.PasswordHandler.ChangePassword, authenticated...)
+		auth.POST("/password/forgot", h.PasswordHandler.ForgotPassword)
+		auth.POST("/password/reset", h.PasswordHandler.ResetPassword)
+
+		// Email verification
+		auth.POST("/verify-email", h.VerifyHandler.VerifyEmail)
+		auth.POST("/verify-email/resend", h.VerifyHandler.ResendVerification)
+
+		// Two-factor authentication
+		auth.POST("/2fa/verify", h.AuthHandler.VerifyTwoFactor)
+		auth.POST("/2fa/setup", h.TwoFactorHandler.Setup, authenticated...)
+		auth.POST("/2fa/enable", h.TwoFactorHandler.Enable, authenticated...)
+		auth.POST("/2fa/disable", h.TwoFactorHandler.Disable, authenticated...)
+		auth.POST("/2fa/recovery-codes", h.TwoFactorHandler.RegenerateRecoveryCodes, authenticated...)
+
+		// Single sign-on
+		auth.GET("/oidc/providers", h.OIDCHandler.GetProviders)
+		auth.GET("/oidc/:provider/login", h.OIDCHandler.Login)
+		auth.GET("/oidc/:provider/callback", h.OIDCHandler.Callback)
 	}
 
 	users := api.Group("/users")
-	users.Use(echojwt.WithConfig(jwtConfig))
+	users.Use(authenticated...)
 	{
 		users.GET("/me", h.UserHandler.GetMe)
 		users.GET("", h.UserHandler.GetAllUsers)
@@ -73,16 +97,63 @@ func SetupRoutes(e *echo.Echo, h *Handlers) {
 
 	// Room routes
 	rooms := api.Group("/rooms")
-	rooms.Use(echojwt.WithConfig(jwtConfig))
+	rooms.Use(authenticated...)
 	{
-		rooms.POST("", h.RoomHandler.CreateRoom)
+		rooms.POST("", h.RoomHandler.CreateRoom, m.RequireVerifiedEmail)
 		rooms.GET("/my", h.RoomHandler.GetMyRooms)
 		rooms.GET("/:id", h.RoomHandler.GetRoomByID)
+
+		// Membership
+		rooms.GET("/:id/members", h.RoomHandler.GetMembers)
+		rooms.POST("/:id/members", h.RoomHandler.AddMember, m.RequireVerifiedEmail)
+		rooms.DELETE("/:id/members/me", h.RoomHandler.LeaveRoom)
+		rooms.DELETE("/:id/members/:userId", h.RoomHandler.RemoveMember)
+		rooms.PATCH("/:id/members/:userId", h.RoomHandler.UpdateMemberRole)
+		rooms.POST("/:id/members/:userId/transfer-ownership", h.RoomHandler.TransferOwnership)
+
+		// Message history
+		rooms.GET("/:id/messages", h.MessageHandler.GetRoomMessages)
+		rooms.POST("/:id/read", h.MessageHandler.MarkRoomRead)
+	}
+
+	// Message routes
+	messages := api.Group("/messages")
+	messages.Use(authenticated...)
+	{
+		messages.GET("/:id", h.MessageHandler.GetMessageByID)
+		messages.PATCH("/:id", h.MessageHandler.UpdateMessage, m.RequireVerifiedEmail)
+		messages.DELETE("/:id", h.MessageHandler.DeleteMessage)
+
+		// Reactions
+		messages.POST("/:id/reactions", h.MessageHandler.AddReaction, m.RequireVerifiedEmail)
+		messages.DELETE("/:id/reactions/:emoji", h.MessageHandler.RemoveReaction)
+	}
+
+	// Upload routes
+	uploads := api.Group("/uploads")
+	uploads.Use(authenticated...)
+	uploads.Use(m.RequireVerifiedEmail)
+	{
+		uploads.POST("", h.UploadHandler.Upload)
+		uploads.POST("/sessions", h.UploadHandler.StartUpload)
+		uploads.GET("/sessions/:id", h.UploadHandler.GetUpload)
+		uploads.PATCH("/sessions/:id", h.UploadHandler.UploadChunk)
+	}
+
+	// Attachment routes. Downloads also accept a signed link instead of a token.
+	attachments := api.Group("/attachments")
+	{
+		attachments.GET("/:id", h.AttachmentHandler.Download, m.AuthenticateUnlessSigned)
+		attachments.HEAD("/:id", h.AttachmentHandler.Download, m.AuthenticateUnlessSigned)
+		attachments.GET("/:id/thumbnail", h.AttachmentHandler.DownloadThumbnail, m.AuthenticateUnlessSigned)
+		attachments.HEAD("/:id/thumbnail", h.AttachmentHandler.DownloadThumbnail, m.AuthenticateUnlessSigned)
+		attachments.GET("/:id/url", h.AttachmentHandler.GetSignedURL, authenticated...)
 	}
 
 	// WebSocket routes
 	ws := api.Group("/ws")
-	ws.Use(echojwt.WithConfig(jwtConfig))
+	ws.Use(authenticated...)
+	ws.Use(m.RequireVerifiedEmail)
 	{
 		ws.GET("/chat", h.WebSocketHandler.HandleWebSocket)
 	}
@@ -0,0 +1,107 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	clamAVChunkSize = 64 << 10
+	// clamAVTimeout bounds a scan when the context has no earlier deadline
+	clamAVTimeout = 5 * time.Minute
+)
+
+type clamAVScanner struct {
+	addr string
+}
+
+// NewClamAV scans with a clamd daemon over TCP using its INSTREAM command.
+// clamd refuses streams over its StreamMaxLength, so that should be at least
+// the largest upload allowed.
+func NewClamAV(addr string) Scanner {
+	return &clamAVScanner{addr: addr}
+}
+
+func (s *clamAVScanner) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("clamav: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(clamAVTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+
+	if err := stream(conn, r); err != nil {
+		// clamd stops reading and replies early, e.g. when the size limit is hit
+		if reply, readErr := readReply(conn); readErr == nil {
+			return parseReply(reply)
+		}
+		return nil, fmt.Errorf("clamav: %w", err)
+	}
+
+	reply, err := readReply(conn)
+	if err != nil {
+		return nil, fmt.Errorf("clamav: %w", err)
+	}
+	return parseReply(reply)
+}
+
+// stream sends the content as length-prefixed chunks, ending with an empty one
+func stream(conn net.Conn, r io.Reader) error {
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return err
+	}
+
+	chunk := make([]byte, 4+clamAVChunkSize)
+	for {
+		n, err := io.ReadFull(r, chunk[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(chunk, uint32(n))
+			if _, err := conn.Write(chunk[:4+n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := conn.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// readReply reads the null-terminated reply the z prefix asks for
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(reply, "\x00"), nil
+}
+
+// parseReply reads "stream: OK", "stream: <signature> FOUND" or "<message> ERROR"
+func parseReply(reply string) (*Result, error) {
+	verdict := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case verdict == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	default:
+		return nil, fmt.Errorf("clamav: %s", reply)
+	}
+}
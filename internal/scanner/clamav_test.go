@@ -0,0 +1,135 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		reply     string
+		infected  bool
+		signature string
+		wantErr   bool
+	}{
+		{reply: "stream: OK"},
+		{reply: "stream: Eicar-Test-Signature FOUND", infected: true, signature: "Eicar-Test-Signature"},
+		{reply: "INSTREAM size limit exceeded. ERROR", wantErr: true},
+		{reply: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reply, func(t *testing.T) {
+			result, err := parseReply(tt.reply)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Infected != tt.infected || result.Signature != tt.signature {
+				t.Errorf("got %+v", result)
+			}
+		})
+	}
+}
+
+// fakeClamd accepts one INSTREAM scan, sends the content it received on
+// received and answers with reply
+func fakeClamd(t *testing.T, reply string) (string, <-chan []byte) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		if command, err := r.ReadString(0); err != nil || command != "zINSTREAM\x00" {
+			return
+		}
+		var content []byte
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			chunk := make([]byte, size)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return
+			}
+			content = append(content, chunk...)
+		}
+		received <- content
+		io.WriteString(conn, reply+"\x00")
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestClamAVScan(t *testing.T) {
+	addr, received := fakeClamd(t, "stream: Eicar-Test-Signature FOUND")
+	// More than one chunk, with a partial one at the end
+	content := bytes.Repeat([]byte("x"), clamAVChunkSize+100)
+
+	result, err := NewClamAV(addr).Scan(context.Background(), bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Infected || result.Signature != "Eicar-Test-Signature" {
+		t.Errorf("got %+v", result)
+	}
+	if got := <-received; !bytes.Equal(got, content) {
+		t.Errorf("clamd received %d bytes, want %d", len(got), len(content))
+	}
+}
+
+func TestClamAVScanUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	_, err = NewClamAV(addr).Scan(context.Background(), strings.NewReader("content"))
+	if err == nil {
+		t.Error("got a verdict without clamd")
+	}
+}
+
+func TestNewFromEnvRequiresScannerOutsideDevelopment(t *testing.T) {
+	t.Setenv("SCANNER", "")
+	t.Setenv("ENV", "production")
+	if _, err := NewFromEnv(); err == nil {
+		t.Error("unset SCANNER was accepted in production")
+	}
+
+	t.Setenv("ENV", "development")
+	if _, err := NewFromEnv(); err != nil {
+		t.Errorf("unset SCANNER was rejected in development: %v", err)
+	}
+
+	t.Setenv("SCANNER", "virustotal")
+	if _, err := NewFromEnv(); err == nil {
+		t.Error("unknown scanner was accepted")
+	}
+}
@@ -0,0 +1,41 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// eicar is the standard antivirus test file, which every scanner flags
+var eicar = []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`)
+
+type noopScanner struct{}
+
+// NewNoop passes all content without reading it, for deployments that don't scan
+func NewNoop() Scanner {
+	return &noopScanner{}
+}
+
+func (s *noopScanner) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	return &Result{}, nil
+}
+
+type fakeScanner struct{}
+
+// NewFake flags content containing the EICAR test string, so quarantine can
+// be exercised without running a real scanner
+func NewFake() Scanner {
+	return &fakeScanner{}
+}
+
+func (s *fakeScanner) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Contains(content, eicar) {
+		return &Result{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+	return &Result{}, nil
+}
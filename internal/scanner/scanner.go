@@ -0,0 +1,48 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Scanner checks file content for malware before it is shared
+type Scanner interface {
+	// Scan reads r to the end. An error means no verdict was reached, not that
+	// the content is unsafe.
+	Scan(ctx context.Context, r io.Reader) (*Result, error)
+}
+
+type Result struct {
+	Infected bool
+	// Signature names what was found in infected content
+	Signature string
+}
+
+// NewFromEnv picks a scanner using SCANNER: "clamav" sends files to the clamd
+// at CLAMAV_ADDR (default "localhost:3310"), "fake" only flags the EICAR test
+// file, and "none" passes everything. Every upload must be scanned, so SCANNER
+// may only be left unset, falling back to "none", when ENV is "development".
+func NewFromEnv() (Scanner, error) {
+	switch name := os.Getenv("SCANNER"); name {
+	case "":
+		if os.Getenv("ENV") != "development" {
+			return nil, errors.New("SCANNER must be set outside development")
+		}
+		return NewNoop(), nil
+	case "none":
+		return NewNoop(), nil
+	case "fake":
+		return NewFake(), nil
+	case "clamav":
+		addr := os.Getenv("CLAMAV_ADDR")
+		if addr == "" {
+			addr = "localhost:3310"
+		}
+		return NewClamAV(addr), nil
+	default:
+		return nil, fmt.Errorf("unknown SCANNER %q", name)
+	}
+}
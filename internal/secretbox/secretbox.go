@@ -0,0 +1,90 @@
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// sealedPrefix marks a sealed value and the format it was sealed with
+const sealedPrefix = "v1:"
+
+var ErrCannotOpen = errors.New("sealed value is malformed or was sealed with another key")
+
+// Box encrypts secrets the app has to read back, such as TOTP secrets, so
+// reading the database alone doesn't reveal them. It uses AES-256-GCM.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New creates a Box from a 32-byte key
+func New(key []byte) (*Box, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// NewFromEnv reads the key from SECRET_ENCRYPTION_KEY, base64 encoded. It is
+// required: a key that changed or went missing would leave every sealed
+// secret unreadable.
+func NewFromEnv() (*Box, error) {
+	encoded := strings.TrimSpace(os.Getenv("SECRET_ENCRYPTION_KEY"))
+	if encoded == "" {
+		return nil, errors.New("SECRET_ENCRYPTION_KEY must be set")
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("SECRET_ENCRYPTION_KEY: %w", err)
+	}
+	return New(key)
+}
+
+// Seal encrypts plaintext. The same context must be given to Open, which ties
+// the value to its owner so it can't be copied to another row.
+func (b *Box) Seal(plaintext string, context []byte) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), context)
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value returned by Seal
+func (b *Box) Open(value string, context []byte) (string, error) {
+	encoded, ok := strings.CutPrefix(value, sealedPrefix)
+	if !ok {
+		return "", ErrCannotOpen
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < b.aead.NonceSize() {
+		return "", ErrCannotOpen
+	}
+
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, context)
+	if err != nil {
+		return "", ErrCannotOpen
+	}
+	return string(plaintext), nil
+}
+
+// IsSealed reports whether value was returned by Seal, rather than stored
+// before secrets were encrypted
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
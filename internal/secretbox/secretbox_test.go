@@ -0,0 +1,91 @@
+package secretbox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestBox(t *testing.T, fill byte) *Box {
+	t.Helper()
+	box, err := New(bytes.Repeat([]byte{fill}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return box
+}
+
+func TestSealOpen(t *testing.T) {
+	box := newTestBox(t, 1)
+	context := []byte("user-1")
+
+	sealed, err := box.Seal("JBSWY3DPEHPK3PXP", context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(sealed) || strings.Contains(sealed, "JBSWY3DPEHPK3PXP") {
+		t.Fatalf("got %q, want a sealed value", sealed)
+	}
+
+	opened, err := box.Open(sealed, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("got %q back", opened)
+	}
+
+	// A fresh nonce is used every time
+	again, _ := box.Seal("JBSWY3DPEHPK3PXP", context)
+	if again == sealed {
+		t.Error("sealing twice gave the same value")
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	box := newTestBox(t, 1)
+	sealed, err := box.Seal("secret", []byte("user-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := []byte(sealed)
+	tampered[len(tampered)/2] ^= 1
+
+	tests := map[string]struct {
+		box     *Box
+		value   string
+		context string
+	}{
+		"other context": {box, sealed, "user-2"},
+		"other key":     {newTestBox(t, 2), sealed, "user-1"},
+		"tampered":      {box, string(tampered), "user-1"},
+		"unsealed":      {box, "secret", "user-1"},
+		"truncated":     {box, sealedPrefix + "AAAA", "user-1"},
+		"not base64":    {box, sealedPrefix + "!!!", "user-1"},
+	}
+	for name, tt := range tests {
+		if _, err := tt.box.Open(tt.value, []byte(tt.context)); !errors.Is(err, ErrCannotOpen) {
+			t.Errorf("%s: got %v, want ErrCannotOpen", name, err)
+		}
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	t.Setenv("SECRET_ENCRYPTION_KEY", "")
+	if _, err := NewFromEnv(); err == nil {
+		t.Error("missing key was accepted")
+	}
+
+	t.Setenv("SECRET_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(make([]byte, 16)))
+	if _, err := NewFromEnv(); err == nil {
+		t.Error("16-byte key was accepted")
+	}
+
+	t.Setenv("SECRET_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if _, err := NewFromEnv(); err != nil {
+		t.Errorf("32-byte key was rejected: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"github.com/kevinsofyan/echoes-chat-api/internal/repositories"
+	"github.com/kevinsofyan/echoes-chat-api/internal/signing"
+	"github.com/kevinsofyan/echoes-chat-api/internal/storage"
+)
+
+type AttachmentService interface {
+	// GetAttachment returns an attachment the user may download: their own
+	// unsent uploads, and cleared files sent in rooms they belong to
+	GetAttachment(ctx context.Context, id, userID uuid.UUID) (*models.Attachment, error)
+	// GetSignedAttachment returns the attachment a signed URL grants access
+	// to, either to the file or to its thumbnail
+	GetSignedAttachment(ctx context.Context, id uuid.UUID, thumbnail bool, expires time.Time, signature string) (*models.Attachment, error)
+	// SignURL creates short-lived download links that need no Authorization header
+	SignURL(ctx context.Context, id, userID uuid.UUID) (*SignedURL, error)
+	// Open reads the attachment's content, seeking with ranged reads
+	Open(ctx context.Context, attachment *models.Attachment) io.ReadSeekCloser
+	// OpenThumbnail reads the preview rendered for an image
+	OpenThumbnail(ctx context.Context, attachment *models.Attachment) (io.ReadSeeker, error)
+}
+
+type SignedURL struct {
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+var (
+	ErrAttachmentNotFound    = errors.New("attachment not found")
+	ErrAttachmentQuarantined = errors.New("attachment was quarantined by the malware scanner")
+	ErrThumbnailNotFound     = errors.New("attachment has no thumbnail")
+	ErrInvalidSignedURL      = errors.New("invalid or expired download link")
+)
+
+const signedURLTTL = 15 * time.Minute
+
+type attachmentService struct {
+	attachmentRepo repositories.AttachmentRepository
+	messageRepo    repositories.MessageRepository
+	memberRepo     repositories.RoomMemberRepository
+	store          storage.Storage
+	urlSigner      *signing.URLSigner
+}
+
+func NewAttachmentService(
+	attachmentRepo repositories.AttachmentRepository,
+	messageRepo repositories.MessageRepository,
+	memberRepo repositories.RoomMemberRepository,
+	store storage.Storage,
+	urlSigner *signing.URLSigner,
+) AttachmentService {
+	return &attachmentService{
+		attachmentRepo: attachmentRepo,
+		messageRepo:    messageRepo,
+		memberRepo:     memberRepo,
+		store:          store,
+		urlSigner:      urlSigner,
+	}
+}
+
+func (s *attachmentService) GetAttachment(ctx context.Context, id, userID uuid.UUID) (*models.Attachment, error) {
+	attachment, err := s.findAttachment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Until it is sent, an upload is private to the uploader
+	if attachment.MessageID == nil {
+		if attachment.UploaderID != userID {
+			return nil, ErrAttachmentNotFound
+		}
+		if attachment.Status == models.AttachmentStatusQuarantined {
+			return nil, ErrAttachmentQuarantined
+		}
+		return attachment, nil
+	}
+
+	// Deleting a message also takes its files out of reach
+	message, err := s.messageRepo.FindByID(ctx, *attachment.MessageID)
+	if err != nil {
+		return nil, ErrAttachmentNotFound
+	}
+
+	if _, err := s.memberRepo.FindByRoomAndUser(ctx, message.RoomID, userID); err != nil {
+		if errors.Is(err, repositories.ErrMemberNotFound) {
+			return nil, ErrNotRoomMember
+		}
+		return nil, err
+	}
+
+	// Others only get the files once all of them are scanned and location
+	// data has been stripped, as they don't see the message until then
+	if message.IsWithheld() && message.SenderID != userID {
+		return nil, ErrAttachmentNotFound
+	}
+
+	if attachment.Status == models.AttachmentStatusQuarantined {
+		return nil, ErrAttachmentQuarantined
+	}
+
+	return attachment, nil
+}
+
+func (s *attachmentService) GetSignedAttachment(ctx context.Context, id uuid.UUID, thumbnail bool, expires time.Time, signature string) (*models.Attachment, error) {
+	if time.Now().After(expires) || !s.urlSigner.Verify(signedResource(id, thumbnail), expires, signature) {
+		return nil, ErrInvalidSignedURL
+	}
+
+	attachment, err := s.findAttachment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Links handed out while the file was being scanned stop working if it fails
+	if attachment.Status == models.AttachmentStatusQuarantined {
+		return nil, ErrAttachmentQuarantined
+	}
+
+	// A link outlives neither its message nor the message's deletion
+	if attachment.MessageID != nil {
+		if _, err := s.messageRepo.FindByID(ctx, *attachment.MessageID); err != nil {
+			return nil, ErrAttachmentNotFound
+		}
+	}
+
+	return attachment, nil
+}
+
+func (s *attachmentService) SignURL(ctx context.Context, id, userID uuid.UUID) (*SignedURL, error) {
+	attachment, err := s.GetAttachment(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Whole seconds, since the expiry travels as a Unix timestamp
+	expires := time.Now().Add(signedURLTTL).Truncate(time.Second)
+
+	signed := &SignedURL{
+		URL:       s.signedPath(id, false, expires),
+		ExpiresAt: expires,
+	}
+	if attachment.ThumbnailKey != "" {
+		signed.ThumbnailURL = s.signedPath(id, true, expires)
+	}
+	return signed, nil
+}
+
+func (s *attachmentService) signedPath(id uuid.UUID, thumbnail bool, expires time.Time) string {
+	resource := signedResource(id, thumbnail)
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("sig", s.urlSigner.Sign(resource, expires))
+
+	return "/api/v1/" + resource + "?" + query.Encode()
+}
+
+func (s *attachmentService) Open(ctx context.Context, attachment *models.Attachment) io.ReadSeekCloser {
+	return storage.NewReadSeeker(ctx, s.store, attachment.StorageKey, attachment.Size)
+}
+
+func (s *attachmentService) OpenThumbnail(ctx context.Context, attachment *models.Attachment) (io.ReadSeeker, error) {
+	if attachment.ThumbnailKey == "" {
+		return nil, ErrThumbnailNotFound
+	}
+
+	object, err := s.store.Get(ctx, attachment.ThumbnailKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrThumbnailNotFound
+		}
+		return nil, err
+	}
+	defer object.Close()
+
+	// Thumbnails are small enough to hold in memory for seeking
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+func (s *attachmentService) findAttachment(ctx context.Context, id uuid.UUID) (*models.Attachment, error) {
+	attachment, err := s.attachmentRepo.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrAttachmentNotFound) {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// signedResource is what a download link's signature covers, which is also its path
+func signedResource(id uuid.UUID, thumbnail bool) string {
+	if thumbnail {
+		return "attachments/" + id.String() + "/thumbnail"
+	}
+	return "attachments/" + id.String()
+}
@@ -3,18 +3,32 @@ package services
 import (
 	"context"
 	"errors"
+	"log"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/kevinsofyan/echoes-chat-api/internal/models"
 	"github.com/kevinsofyan/echoes-chat-api/internal/repositories"
+	"github.com/kevinsofyan/echoes-chat-api/internal/signing"
 	"github.com/kevinsofyan/echoes-chat-api/internal/utils"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthService interface {
 	Register(ctx context.Context, req RegisterRequest) (*models.User, error)
-	Login(ctx context.Context, req LoginRequest) (*models.User, string, error)
-	Logout(ctx context.Context, token string) error
+	// Login returns tokens, or a challenge when the user has two-factor enabled
+	Login(ctx context.Context, req LoginRequest, device SessionMetadata) (*LoginResult, error)
+	// LoginVerified signs in a user whose identity was already established, such as
+	// through single sign-on. Two-factor still applies.
+	LoginVerified(ctx context.Context, user *models.User, device SessionMetadata) (*LoginResult, error)
+	// VerifyTwoFactor completes a login that returned a challenge
+	VerifyTwoFactor(ctx context.Context, req VerifyTwoFactorRequest, device SessionMetadata) (*LoginResult, error)
+	Refresh(ctx context.Context, req RefreshRequest, device SessionMetadata) (*TokenPair, error)
+	// Logout ends the current session only; other devices stay signed in
+	Logout(ctx context.Context, userID, sessionID uuid.UUID) error
+	GetSessions(ctx context.Context, userID, currentSessionID uuid.UUID) ([]models.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	RevokeOtherSessions(ctx context.Context, userID, currentSessionID uuid.UUID) error
 	ValidateToken(ctx context.Context, tokenString string) (*models.Token, error)
 }
 
@@ -30,20 +44,80 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// TokenPair is returned on login and on every refresh. The refresh token is
+// single-use: each refresh returns a new one and consumes the old.
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// LoginResult carries either Tokens or, when a second factor is still needed, Challenge
+type LoginResult struct {
+	User      *models.User
+	Tokens    *TokenPair
+	Challenge *TwoFactorChallenge
+}
+
+// SessionMetadata describes the device a session was signed in from
+type SessionMetadata struct {
+	UserAgent string
+	IPAddress string
+}
+
 type UpdateUserRequest struct {
 	FullName string `json:"full_name"`
 	Avatar   string `json:"avatar"`
 }
 
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+	ErrSessionNotFound     = errors.New("session not found")
+)
+
+const refreshTokenTTL = 30 * 24 * time.Hour
+
+// dummyPasswordHash is compared against when the email is unknown
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("echoes-chat-dummy-password"), bcrypt.DefaultCost)
+
 type authService struct {
-	userRepo  repositories.UserRepository
-	tokenRepo repositories.TokenRepository
+	userRepo          repositories.UserRepository
+	tokenRepo         repositories.TokenRepository
+	refreshTokenRepo  repositories.RefreshTokenRepository
+	sessionRepo       repositories.SessionRepository
+	revocationService TokenRevocationService
+	verification      EmailVerificationService
+	twoFactor         TwoFactorService
+	loginGuard        LoginGuard
+	signer            signing.Signer
 }
 
-func NewAuthService(userRepo repositories.UserRepository, tokenRepo repositories.TokenRepository) AuthService {
+func NewAuthService(
+	userRepo repositories.UserRepository,
+	tokenRepo repositories.TokenRepository,
+	refreshTokenRepo repositories.RefreshTokenRepository,
+	sessionRepo repositories.SessionRepository,
+	revocationService TokenRevocationService,
+	verification EmailVerificationService,
+	twoFactor TwoFactorService,
+	loginGuard LoginGuard,
+	signer signing.Signer,
+) AuthService {
 	return &authService{
-		userRepo:  userRepo,
-		tokenRepo: tokenRepo,
+		userRepo:          userRepo,
+		tokenRepo:         tokenRepo,
+		refreshTokenRepo:  refreshTokenRepo,
+		sessionRepo:       sessionRepo,
+		revocationService: revocationService,
+		verification:      verification,
+		twoFactor:         twoFactor,
+		loginGuard:        loginGuard,
+		signer:            signer,
 	}
 }
 
@@ -75,57 +149,222 @@ func (s *authService) Register(ctx context.Context, req RegisterRequest) (*model
 		return nil, err
 	}
 
+	// The account exists either way; the user can ask for another email
+	if err := s.verification.SendVerification(ctx, user); err != nil {
+		log.Printf("error sending verification email to user %s: %v", user.ID, err)
+	}
+
 	user.Password = ""
 	return user, nil
 }
 
-func (s *authService) Login(ctx context.Context, req LoginRequest) (*models.User, string, error) {
+func (s *authService) Login(ctx context.Context, req LoginRequest, device SessionMetadata) (*LoginResult, error) {
+	attempt := LoginAttempt{Email: req.Email, Device: device}
+	if err := s.loginGuard.Reserve(ctx, attempt); err != nil {
+		return nil, err
+	}
+
 	user, err := s.userRepo.FindByEmail(ctx, req.Email)
 	if err != nil {
-		return nil, "", errors.New("invalid credentials")
+		// Spend the same time as a password check so unknown emails can't be told apart
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		s.loginGuard.RecordFailure(ctx, attempt, models.LoginFailureUnknownEmail)
+		return nil, errors.New("invalid credentials")
 	}
+	attempt.UserID = &user.ID
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		return nil, "", errors.New("invalid credentials")
+		s.loginGuard.RecordFailure(ctx, attempt, models.LoginFailureWrongPassword)
+		return nil, errors.New("invalid credentials")
 	}
 
-	tokenString, err := utils.GenerateToken(user.ID, user.Username, user.Email)
+	// The password was right, so the attempt isn't held against the account.
+	// Earlier failures stay until the user is fully signed in: wrong two-factor
+	// codes count against the account too, and a correct password mustn't wipe them.
+	s.loginGuard.Release(ctx, attempt)
+
+	if s.verification.Policy() == VerificationBlock && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+
+	result, err := s.LoginVerified(ctx, user, device)
 	if err != nil {
-		return nil, "", errors.New("failed to generate token")
+		return nil, err
 	}
 
-	token := &models.Token{
-		UserID:    user.ID,
-		Token:     tokenString,
-		ExpiresAt: time.Now().Add(24 * time.Hour),
+	if result.Tokens != nil {
+		s.loginGuard.RecordSuccess(ctx, attempt)
 	}
+	return result, nil
+}
 
-	if err := s.tokenRepo.Create(ctx, token); err != nil {
-		return nil, "", errors.New("failed to store token")
+func (s *authService) LoginVerified(ctx context.Context, user *models.User, device SessionMetadata) (*LoginResult, error) {
+	// No tokens are issued until the second factor is checked
+	if user.TwoFactorEnabledAt != nil {
+		challenge, err := s.twoFactor.CreateChallenge(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{Challenge: challenge}, nil
 	}
 
-	s.userRepo.UpdateOnlineStatus(ctx, user.ID, true)
+	return s.startSession(ctx, user, device)
+}
 
-	user.Password = ""
-	return user, tokenString, nil
+// VerifyTwoFactor completes a login with the second factor. Wrong codes count
+// against the account like wrong passwords, so guessing codes across fresh
+// challenges is throttled too.
+func (s *authService) VerifyTwoFactor(ctx context.Context, req VerifyTwoFactorRequest, device SessionMetadata) (*LoginResult, error) {
+	userID, err := s.twoFactor.ChallengeUser(ctx, req.ChallengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	attempt := LoginAttempt{Email: user.Email, UserID: &user.ID, Device: device}
+	if err := s.loginGuard.Reserve(ctx, attempt); err != nil {
+		return nil, err
+	}
+
+	_, err = s.twoFactor.VerifyChallenge(ctx, req)
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		s.loginGuard.RecordFailure(ctx, attempt, models.LoginFailureTwoFactorCode)
+		return nil, err
+	}
+	s.loginGuard.Release(ctx, attempt)
+	if err != nil {
+		return nil, err
+	}
+	s.loginGuard.RecordSuccess(ctx, attempt)
+
+	return s.startSession(ctx, user, device)
 }
 
-func (s *authService) Logout(ctx context.Context, token string) error {
-	tokenData, err := s.tokenRepo.FindByToken(ctx, token)
+// Refresh exchanges a refresh token for a new token pair. Presenting a token
+// that was already exchanged means it leaked or was stolen, so the whole
+// session is ended, including access tokens issued to it.
+func (s *authService) Refresh(ctx context.Context, req RefreshRequest, device SessionMetadata) (*TokenPair, error) {
+	current, err := s.refreshTokenRepo.FindByHash(ctx, utils.HashToken(req.RefreshToken))
 	if err != nil {
-		return errors.New("invalid token")
+		if errors.Is(err, repositories.ErrRefreshTokenNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if current.RevokedAt != nil || time.Now().After(current.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if current.UsedAt != nil {
+		return nil, s.revokeReusedFamily(ctx, current.FamilyID)
+	}
+
+	consumed, err := s.refreshTokenRepo.MarkUsed(ctx, current.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		// Another request exchanged the same token first
+		return nil, s.revokeReusedFamily(ctx, current.FamilyID)
+	}
+
+	if _, err := s.sessionRepo.FindActiveByID(ctx, current.FamilyID); err != nil {
+		if errors.Is(err, repositories.ErrSessionNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if err := s.sessionRepo.Touch(ctx, current.FamilyID, device.UserAgent, device.IPAddress); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(ctx, current.UserID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	tokens, next, err := s.issueTokens(ctx, user, current.FamilyID)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.tokenRepo.DeleteByUserID(ctx, tokenData.UserID); err != nil {
+	if err := s.refreshTokenRepo.SetReplacedBy(ctx, current.ID, next.ID); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (s *authService) Logout(ctx context.Context, userID, sessionID uuid.UUID) error {
+	if err := s.RevokeSession(ctx, userID, sessionID); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return errors.New("invalid token")
+		}
 		return errors.New("failed to logout")
 	}
 
-	s.userRepo.UpdateOnlineStatus(ctx, tokenData.UserID, false)
+	return nil
+}
+
+func (s *authService) GetSessions(ctx context.Context, userID, currentSessionID uuid.UUID) ([]models.Session, error) {
+	sessions, err := s.sessionRepo.FindActiveByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+	return sessions, nil
+}
+
+func (s *authService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	session, err := s.sessionRepo.FindActiveByID(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrSessionNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
 
+	// Another user's session is reported as missing rather than forbidden
+	if session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	return s.endSession(ctx, sessionID)
+}
+
+// RevokeOtherSessions signs out every device except the one making the request
+func (s *authService) RevokeOtherSessions(ctx context.Context, userID, currentSessionID uuid.UUID) error {
+	sessions, err := s.sessionRepo.FindActiveByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.ID == currentSessionID {
+			continue
+		}
+		if err := s.endSession(ctx, session.ID); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (s *authService) ValidateToken(ctx context.Context, tokenString string) (*models.Token, error) {
+	var claims utils.JWTClaims
+	if _, err := utils.NewAccessTokenParser().ParseWithClaims(tokenString, &claims, s.signer.Keyfunc); err != nil {
+		return nil, errors.New("invalid or expired token")
+	}
+
 	token, err := s.tokenRepo.FindByToken(ctx, tokenString)
 	if err != nil {
 		return nil, errors.New("invalid or expired token")
@@ -133,3 +372,89 @@ func (s *authService) ValidateToken(ctx context.Context, tokenString string) (*m
 
 	return token, nil
 }
+
+// startSession signs a user in on a new device. Each session is also a refresh token family.
+func (s *authService) startSession(ctx context.Context, user *models.User, device SessionMetadata) (*LoginResult, error) {
+	session := &models.Session{
+		UserID:     user.ID,
+		UserAgent:  device.UserAgent,
+		IPAddress:  device.IPAddress,
+		LastUsedAt: time.Now(),
+	}
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, errors.New("failed to create session")
+	}
+
+	tokens, _, err := s.issueTokens(ctx, user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Password = ""
+	return &LoginResult{User: user, Tokens: tokens}, nil
+}
+
+// issueTokens creates an access token and a refresh token for a session
+func (s *authService) issueTokens(ctx context.Context, user *models.User, sessionID uuid.UUID) (*TokenPair, *models.RefreshToken, error) {
+	tokenID := uuid.New()
+	accessToken, err := utils.GenerateToken(s.signer, tokenID, sessionID, user.ID, user.Username, user.Email)
+	if err != nil {
+		return nil, nil, errors.New("failed to generate token")
+	}
+
+	token := &models.Token{
+		UserID:    user.ID,
+		Token:     accessToken,
+		JTI:       tokenID,
+		SessionID: sessionID,
+		ExpiresAt: time.Now().Add(utils.AccessTokenTTL),
+	}
+
+	if err := s.tokenRepo.Create(ctx, token); err != nil {
+		return nil, nil, errors.New("failed to store token")
+	}
+
+	refreshToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, nil, errors.New("failed to generate token")
+	}
+
+	refresh := &models.RefreshToken{
+		UserID:        user.ID,
+		FamilyID:      sessionID,
+		TokenHash:     utils.HashToken(refreshToken),
+		AccessTokenID: tokenID,
+		ExpiresAt:     time.Now().Add(refreshTokenTTL),
+	}
+
+	if err := s.refreshTokenRepo.Create(ctx, refresh); err != nil {
+		return nil, nil, errors.New("failed to store token")
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(utils.AccessTokenTTL.Seconds()),
+	}, refresh, nil
+}
+
+// revokeReusedFamily handles a replayed refresh token and always returns ErrRefreshTokenReused
+func (s *authService) revokeReusedFamily(ctx context.Context, familyID uuid.UUID) error {
+	if err := s.endSession(ctx, familyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// endSession revokes the session's refresh tokens and access tokens and closes its connections
+func (s *authService) endSession(ctx context.Context, sessionID uuid.UUID) error {
+	if err := s.sessionRepo.Revoke(ctx, sessionID); err != nil {
+		return err
+	}
+
+	if err := s.refreshTokenRepo.RevokeFamily(ctx, sessionID); err != nil {
+		return err
+	}
+
+	return s.revocationService.RevokeSession(ctx, sessionID)
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/mailer"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"github.com/kevinsofyan/echoes-chat-api/internal/repositories"
+	"github.com/kevinsofyan/echoes-chat-api/internal/utils"
+)
+
+// EmailVerificationPolicy decides what unverified accounts may do
+type EmailVerificationPolicy string
+
+const (
+	// VerificationOff treats every account as verified and sends no emails
+	VerificationOff EmailVerificationPolicy = "off"
+	// VerificationRestrict allows login but rejects actions guarded by RequireVerifiedEmail
+	VerificationRestrict EmailVerificationPolicy = "restrict"
+	// VerificationBlock rejects login until the address is verified
+	VerificationBlock EmailVerificationPolicy = "block"
+)
+
+var (
+	ErrEmailNotVerified         = errors.New("email address has not been verified")
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+)
+
+const verificationTokenTTL = 24 * time.Hour
+
+// EmailVerificationPolicyFromEnv reads EMAIL_VERIFICATION_POLICY, defaulting to restrict
+func EmailVerificationPolicyFromEnv() EmailVerificationPolicy {
+	switch policy := EmailVerificationPolicy(os.Getenv("EMAIL_VERIFICATION_POLICY")); policy {
+	case VerificationOff, VerificationRestrict, VerificationBlock:
+		return policy
+	case "":
+		return VerificationRestrict
+	default:
+		log.Printf("unknown EMAIL_VERIFICATION_POLICY %q, using %q", policy, VerificationRestrict)
+		return VerificationRestrict
+	}
+}
+
+type EmailVerificationService interface {
+	Policy() EmailVerificationPolicy
+	// SendVerification emails a fresh verification link, invalidating earlier ones
+	SendVerification(ctx context.Context, user *models.User) error
+	// ResendVerification sends the email in the background. It succeeds for
+	// unknown and already verified addresses too, so the endpoint can't be used
+	// to find out who has an account. Requests are throttled per address and
+	// per ipAddress.
+	ResendVerification(ctx context.Context, req ResendVerificationRequest, ipAddress string) error
+	VerifyEmail(ctx context.Context, req VerifyEmailRequest) error
+	IsVerified(ctx context.Context, userID uuid.UUID) (bool, error)
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type emailVerificationService struct {
+	userRepo   repositories.UserRepository
+	verifyRepo repositories.EmailVerificationRepository
+	mailer     mailer.Mailer
+	throttle   MailThrottle
+	policy     EmailVerificationPolicy
+
+	// verified caches users known to be verified; verification is never undone
+	mu       sync.RWMutex
+	verified map[uuid.UUID]struct{}
+}
+
+func NewEmailVerificationService(
+	userRepo repositories.UserRepository,
+	verifyRepo repositories.EmailVerificationRepository,
+	mailer mailer.Mailer,
+	throttle MailThrottle,
+	policy EmailVerificationPolicy,
+) EmailVerificationService {
+	return &emailVerificationService{
+		userRepo:   userRepo,
+		verifyRepo: verifyRepo,
+		mailer:     mailer,
+		throttle:   throttle,
+		policy:     policy,
+		verified:   make(map[uuid.UUID]struct{}),
+	}
+}
+
+func (s *emailVerificationService) Policy() EmailVerificationPolicy {
+	return s.policy
+}
+
+func (s *emailVerificationService) SendVerification(ctx context.Context, user *models.User) error {
+	if s.policy == VerificationOff {
+		return nil
+	}
+
+	if err := s.verifyRepo.InvalidateByUserID(ctx, user.ID); err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return errors.New("failed to generate token")
+	}
+
+	verification := &models.EmailVerificationToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(verificationTokenTTL),
+	}
+
+	if err := s.verifyRepo.Create(ctx, verification); err != nil {
+		return errors.New("failed to store token")
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nConfirm your email address with the link below. It expires in %d hours.\n\n%s\n",
+			user.Username, int(verificationTokenTTL.Hours()), tokenLink("EMAIL_VERIFICATION_URL", token),
+		),
+	})
+}
+
+func (s *emailVerificationService) ResendVerification(ctx context.Context, req ResendVerificationRequest, ipAddress string) error {
+	if err := s.throttle.Reserve(ctx, req.Email, ipAddress); err != nil {
+		return err
+	}
+
+	sendInBackground("verification email", func(ctx context.Context) error {
+		user, err := s.userRepo.FindByEmail(ctx, req.Email)
+		if err != nil {
+			if errors.Is(err, repositories.ErrUserNotFound) {
+				return nil
+			}
+			return err
+		}
+		if user.EmailVerifiedAt != nil {
+			return nil
+		}
+		return s.SendVerification(ctx, user)
+	})
+	return nil
+}
+
+func (s *emailVerificationService) VerifyEmail(ctx context.Context, req VerifyEmailRequest) error {
+	verification, err := s.verifyRepo.FindValidByHash(ctx, utils.HashToken(req.Token))
+	if err != nil {
+		if errors.Is(err, repositories.ErrVerificationTokenNotFound) {
+			return ErrInvalidVerificationToken
+		}
+		return err
+	}
+
+	consumed, err := s.verifyRepo.MarkUsed(ctx, verification.ID)
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return ErrInvalidVerificationToken
+	}
+
+	if err := s.userRepo.MarkEmailVerified(ctx, verification.UserID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.verified[verification.UserID] = struct{}{}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *emailVerificationService) IsVerified(ctx context.Context, userID uuid.UUID) (bool, error) {
+	if s.policy == VerificationOff {
+		return true, nil
+	}
+
+	s.mu.RLock()
+	_, ok := s.verified[userID]
+	s.mu.RUnlock()
+	if ok {
+		return true, nil
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if user.EmailVerifiedAt == nil {
+		return false, nil
+	}
+
+	s.mu.Lock()
+	s.verified[userID] = struct{}{}
+	s.mu.Unlock()
+	return true, nil
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"github.com/kevinsofyan/echoes-chat-api/internal/ratelimit"
+	"github.com/kevinsofyan/echoes-chat-api/internal/repositories"
+)
+
+var ErrTooManyLoginAttempts = errors.New("too many failed login attempts")
+
+// LoginLockedError reports a throttled login and when it may be retried
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("%s, try again in %s", ErrTooManyLoginAttempts, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LoginLockedError) Is(target error) bool {
+	return target == ErrTooManyLoginAttempts
+}
+
+// Accounts lock quickly; an address gets more room since several users can share it,
+// but is still stopped from spraying passwords across accounts
+var (
+	accountLoginPolicy = ratelimit.Policy{
+		FreeAttempts: 5,
+		BaseLockout:  30 * time.Second,
+		MaxLockout:   15 * time.Minute,
+		Window:       time.Hour,
+	}
+	ipLoginPolicy = ratelimit.Policy{
+		FreeAttempts: 20,
+		BaseLockout:  time.Minute,
+		MaxLockout:   time.Hour,
+		Window:       time.Hour,
+	}
+)
+
+// LoginAttempt describes a sign-in attempt for throttling and auditing
+type LoginAttempt struct {
+	Email  string
+	UserID *uuid.UUID
+	Device SessionMetadata
+}
+
+// LoginGuard throttles failed sign-ins per account and per IP address. Every
+// attempt is counted as a failure up front, so a burst of parallel attempts
+// can't get past the limit while their password checks are still running.
+type LoginGuard interface {
+	// Reserve counts an attempt, or returns a *LoginLockedError if the account or address is locked out
+	Reserve(ctx context.Context, attempt LoginAttempt) error
+	// RecordFailure audits a failed attempt. Reserve has already counted it.
+	RecordFailure(ctx context.Context, attempt LoginAttempt, reason models.LoginFailureReason)
+	// Release hands back an attempt that didn't fail, keeping earlier failures
+	Release(ctx context.Context, attempt LoginAttempt)
+	// RecordSuccess clears the account's failures. The address keeps its
+	// history, so one valid account can't be used to reset a spraying run.
+	RecordSuccess(ctx context.Context, attempt LoginAttempt)
+}
+
+type loginGuard struct {
+	accounts    *ratelimit.Limiter
+	addresses   *ratelimit.Limiter
+	failureRepo repositories.LoginFailureRepository
+}
+
+func NewLoginGuard(store ratelimit.Store, failureRepo repositories.LoginFailureRepository) LoginGuard {
+	return &loginGuard{
+		accounts:    ratelimit.NewLimiter(store, accountLoginPolicy),
+		addresses:   ratelimit.NewLimiter(store, ipLoginPolicy),
+		failureRepo: failureRepo,
+	}
+}
+
+func (g *loginGuard) Reserve(ctx context.Context, attempt LoginAttempt) error {
+	account, err := g.accounts.Reserve(ctx, accountKey(attempt.Email))
+	if err != nil {
+		return err
+	}
+	if account.Wait > 0 {
+		return &LoginLockedError{RetryAfter: account.Wait}
+	}
+
+	if attempt.Device.IPAddress != "" {
+		address, err := g.addresses.Reserve(ctx, ipKey(attempt.Device.IPAddress))
+		if err != nil {
+			g.releaseAccount(ctx, attempt)
+			return err
+		}
+		if address.Wait > 0 {
+			g.releaseAccount(ctx, attempt)
+			return &LoginLockedError{RetryAfter: address.Wait}
+		}
+		if address.Lockout > account.Lockout {
+			account.Lockout = address.Lockout
+		}
+	}
+
+	// Rejected attempts aren't audited, so a locked out caller can't fill the
+	// table. Only the attempt that starts a lockout records it.
+	if account.Lockout > 0 {
+		g.audit(ctx, attempt, models.LoginFailureLockedOut)
+	}
+	return nil
+}
+
+func (g *loginGuard) RecordFailure(ctx context.Context, attempt LoginAttempt, reason models.LoginFailureReason) {
+	g.audit(ctx, attempt, reason)
+}
+
+func (g *loginGuard) Release(ctx context.Context, attempt LoginAttempt) {
+	g.releaseAccount(ctx, attempt)
+	g.releaseAddress(ctx, attempt)
+}
+
+func (g *loginGuard) RecordSuccess(ctx context.Context, attempt LoginAttempt) {
+	if err := g.accounts.Success(ctx, accountKey(attempt.Email)); err != nil {
+		log.Printf("error clearing login failures for %s: %v", attempt.Email, err)
+	}
+}
+
+func (g *loginGuard) releaseAccount(ctx context.Context, attempt LoginAttempt) {
+	if err := g.accounts.Release(ctx, accountKey(attempt.Email)); err != nil {
+		log.Printf("error releasing login attempt for %s: %v", attempt.Email, err)
+	}
+}
+
+func (g *loginGuard) releaseAddress(ctx context.Context, attempt LoginAttempt) {
+	if attempt.Device.IPAddress == "" {
+		return
+	}
+	if err := g.addresses.Release(ctx, ipKey(attempt.Device.IPAddress)); err != nil {
+		log.Printf("error releasing login attempt for %s: %v", attempt.Device.IPAddress, err)
+	}
+}
+
+func (g *loginGuard) audit(ctx context.Context, attempt LoginAttempt, reason models.LoginFailureReason) {
+	failure := &models.LoginFailure{
+		UserID:    attempt.UserID,
+		Email:     attempt.Email,
+		IPAddress: attempt.Device.IPAddress,
+		UserAgent: attempt.Device.UserAgent,
+		Reason:    reason,
+	}
+	if err := g.failureRepo.Create(ctx, failure); err != nil {
+		log.Printf("error auditing login failure for %s: %v", attempt.Email, err)
+	}
+}
+
+// Emails are case-insensitive, so differently cased attempts share a counter
+func accountKey(email string) string {
+	return "login:account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "login:ip:" + ip
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/kevinsofyan/echoes-chat-api/internal/ratelimit"
+)
+
+var ErrTooManyMailRequests = errors.New("too many email requests")
+
+// MailRequestLimitedError reports a throttled request for an email and when it may be retried
+type MailRequestLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *MailRequestLimitedError) Error() string {
+	return fmt.Sprintf("%s, try again in %s", ErrTooManyMailRequests, e.RetryAfter.Round(time.Second))
+}
+
+func (e *MailRequestLimitedError) Is(target error) bool {
+	return target == ErrTooManyMailRequests
+}
+
+// An address only needs a few emails an hour; an IP gets more room since several
+// users can share it, but is still stopped from mailing every address it knows
+var (
+	mailAddressPolicy = ratelimit.Policy{
+		FreeAttempts: 3,
+		BaseLockout:  5 * time.Minute,
+		MaxLockout:   time.Hour,
+		Window:       time.Hour,
+	}
+	mailIPPolicy = ratelimit.Policy{
+		FreeAttempts: 10,
+		BaseLockout:  time.Minute,
+		MaxLockout:   time.Hour,
+		Window:       time.Hour,
+	}
+)
+
+// mailTimeout bounds a background send, which no request is waiting on
+const mailTimeout = time.Minute
+
+// MailThrottle limits the unauthenticated endpoints that send email, per
+// recipient and per IP address. Unknown recipients are counted too, so the
+// limit doesn't reveal who has an account.
+type MailThrottle interface {
+	// Reserve counts a request, or returns a *MailRequestLimitedError if the recipient or address is limited
+	Reserve(ctx context.Context, email, ipAddress string) error
+}
+
+type mailThrottle struct {
+	recipients *ratelimit.Limiter
+	addresses  *ratelimit.Limiter
+}
+
+func NewMailThrottle(store ratelimit.Store) MailThrottle {
+	return &mailThrottle{
+		recipients: ratelimit.NewLimiter(store, mailAddressPolicy),
+		addresses:  ratelimit.NewLimiter(store, mailIPPolicy),
+	}
+}
+
+func (t *mailThrottle) Reserve(ctx context.Context, email, ipAddress string) error {
+	if ipAddress != "" {
+		address, err := t.addresses.Reserve(ctx, "mail:ip:"+ipAddress)
+		if err != nil {
+			return err
+		}
+		if address.Wait > 0 {
+			return &MailRequestLimitedError{RetryAfter: address.Wait}
+		}
+	}
+
+	recipient, err := t.recipients.Reserve(ctx, "mail:recipient:"+strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		return err
+	}
+	if recipient.Wait > 0 {
+		return &MailRequestLimitedError{RetryAfter: recipient.Wait}
+	}
+	return nil
+}
+
+// sendInBackground runs a mail job after the request has been answered, so its
+// timing and failures don't reveal whether the address has an account
+func sendInBackground(what string, send func(ctx context.Context) error) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		if err := send(ctx); err != nil {
+			log.Printf("error sending %s: %v", what, err)
+		}
+	}()
+}
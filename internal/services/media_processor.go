@@ -0,0 +1,346 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/media"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"github.com/kevinsofyan/echoes-chat-api/internal/repositories"
+	"github.com/kevinsofyan/echoes-chat-api/internal/scanner"
+	"github.com/kevinsofyan/echoes-chat-api/internal/storage"
+)
+
+// AttachmentNotifier tells clients that an attachment finished processing.
+// The websocket hub implements it; it is declared here so services don't depend on the hub.
+type AttachmentNotifier interface {
+	// AttachmentProcessed tells the uploader how processing turned out
+	AttachmentProcessed(attachment *models.Attachment)
+	// MessageReleased delivers a withheld message to its room once all of its
+	// attachments are cleared
+	MessageReleased(message *models.Message)
+}
+
+// MediaProcessor scans uploads, then extracts metadata and renders thumbnails
+// in the background. Location data is stripped from images along the way.
+// Files the scanner flags, or that can't be scanned or stripped, are quarantined.
+type MediaProcessor interface {
+	// Enqueue schedules an attachment for processing without waiting for it
+	Enqueue(attachmentID uuid.UUID)
+	// Run processes queued attachments, starting with those a previous run
+	// left unfinished. It never returns.
+	Run()
+}
+
+const (
+	mediaWorkers        = 2
+	mediaQueueSize      = 256
+	mediaProcessTimeout = 5 * time.Minute
+	// thumbnailSize is the longest side of a thumbnail, in pixels
+	thumbnailSize = 480
+
+	// Scanning and location stripping are retried after retryDelay, growing
+	// with each attempt
+	maxProcessAttempts = 5
+	retryDelay         = 30 * time.Second
+	// unscannableSignature marks files quarantined because no scan succeeded
+	unscannableSignature = "unscannable"
+	// unstrippableSignature marks images quarantined because their location
+	// data couldn't be removed
+	unstrippableSignature = "location not stripped"
+)
+
+// errLocationNotStripped wraps failures that leave an image's location data in
+// the stored file, which mustn't then be shared
+var errLocationNotStripped = errors.New("location data not stripped")
+
+type mediaProcessor struct {
+	attachmentRepo repositories.AttachmentRepository
+	messageRepo    repositories.MessageRepository
+	store          storage.Storage
+	scanner        scanner.Scanner
+	notifier       AttachmentNotifier
+
+	queue chan uuid.UUID
+
+	mu       sync.Mutex
+	attempts map[uuid.UUID]int
+}
+
+func NewMediaProcessor(
+	attachmentRepo repositories.AttachmentRepository,
+	messageRepo repositories.MessageRepository,
+	store storage.Storage,
+	scanner scanner.Scanner,
+	notifier AttachmentNotifier,
+) MediaProcessor {
+	return &mediaProcessor{
+		attachmentRepo: attachmentRepo,
+		messageRepo:    messageRepo,
+		store:          store,
+		scanner:        scanner,
+		notifier:       notifier,
+		queue:          make(chan uuid.UUID, mediaQueueSize),
+		attempts:       make(map[uuid.UUID]int),
+	}
+}
+
+func (p *mediaProcessor) Enqueue(attachmentID uuid.UUID) {
+	select {
+	case p.queue <- attachmentID:
+	default:
+		// The upload shouldn't wait for a backlog to clear
+		go func() { p.queue <- attachmentID }()
+	}
+}
+
+func (p *mediaProcessor) Run() {
+	var workers sync.WaitGroup
+	for range mediaWorkers {
+		workers.Go(func() {
+			for id := range p.queue {
+				p.process(id)
+			}
+		})
+	}
+
+	pending, err := p.attachmentRepo.FindProcessing(context.Background())
+	if err != nil {
+		log.Printf("error loading unprocessed attachments: %v", err)
+	}
+	for _, attachment := range pending {
+		p.Enqueue(attachment.ID)
+	}
+
+	workers.Wait()
+}
+
+func (p *mediaProcessor) process(id uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), mediaProcessTimeout)
+	defer cancel()
+
+	attachment, err := p.attachmentRepo.FindByID(ctx, id)
+	if err != nil {
+		log.Printf("error loading attachment %s for processing: %v", id, err)
+		return
+	}
+	if attachment.Status != models.AttachmentStatusProcessing {
+		return
+	}
+
+	now := time.Now()
+	verdict, err := p.scan(ctx, attachment)
+	if err != nil {
+		if p.retryLater(id, "scanning", err) {
+			return
+		}
+		// A file that can't be scanned mustn't be shared unscanned
+		verdict = &scanner.Result{Infected: true, Signature: unscannableSignature}
+	} else {
+		attachment.ScannedAt = &now
+	}
+
+	original := attachment.StorageKey
+	if verdict.Infected {
+		log.Printf("attachment %s quarantined: %s", id, verdict.Signature)
+		attachment.Status = models.AttachmentStatusQuarantined
+		attachment.ScanSignature = verdict.Signature
+	} else {
+		switch attachment.Kind() {
+		case models.MessageTypeImage:
+			err = p.processImage(ctx, attachment)
+		case models.MessageTypeVideo:
+			err = p.processVideo(ctx, attachment)
+		}
+
+		attachment.Status = models.AttachmentStatusReady
+		switch {
+		case errors.Is(err, errLocationNotStripped):
+			if p.retryLater(id, "stripping location from", err) {
+				return
+			}
+			// Sharing the original would reveal where it was taken
+			attachment.Status = models.AttachmentStatusQuarantined
+			attachment.ScanSignature = unstrippableSignature
+		case err != nil:
+			log.Printf("error processing attachment %s: %v", id, err)
+			attachment.Status = models.AttachmentStatusFailed
+		}
+	}
+	attachment.ProcessedAt = &now
+	p.attemptsDone(id)
+
+	saved, err := p.attachmentRepo.CompleteProcessing(ctx, attachment)
+	if err != nil || !saved {
+		if err != nil {
+			log.Printf("error saving processed attachment %s: %v", id, err)
+		}
+		// Another run got there first, or this one is retried after a restart
+		if attachment.StorageKey != original {
+			p.deleteObject(ctx, attachment.StorageKey)
+		}
+		return
+	}
+
+	if attachment.StorageKey != original {
+		p.deleteObject(ctx, original)
+	}
+	p.notify(ctx, id)
+}
+
+func (p *mediaProcessor) scan(ctx context.Context, attachment *models.Attachment) (*scanner.Result, error) {
+	object, err := p.store.Get(ctx, attachment.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	return p.scanner.Scan(ctx, object)
+}
+
+// retryLater counts a failed attempt at an attachment and schedules another,
+// reporting false once the attempts are used up
+func (p *mediaProcessor) retryLater(id uuid.UUID, action string, err error) bool {
+	p.mu.Lock()
+	p.attempts[id]++
+	attempts := p.attempts[id]
+	p.mu.Unlock()
+
+	if attempts >= maxProcessAttempts {
+		log.Printf("error %s attachment %s, quarantining it: %v", action, id, err)
+		return false
+	}
+
+	log.Printf("error %s attachment %s, will retry: %v", action, id, err)
+	time.AfterFunc(time.Duration(attempts)*retryDelay, func() { p.Enqueue(id) })
+	return true
+}
+
+func (p *mediaProcessor) attemptsDone(id uuid.UUID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.attempts, id)
+}
+
+// processImage strips location data from the stored file, then records the
+// image's size, thumbnail and blurhash. Errors up to storing the stripped copy
+// wrap errLocationNotStripped.
+func (p *mediaProcessor) processImage(ctx context.Context, attachment *models.Attachment) error {
+	data, err := p.readObject(ctx, attachment.StorageKey, attachment.Size)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errLocationNotStripped, err)
+	}
+
+	if stripped, changed := media.StripLocation(attachment.ContentType, data); changed {
+		// A new key keeps an object's content fixed, which the download ETag relies on
+		key := "attachments/" + uuid.New().String()
+		if err := p.store.Put(ctx, key, bytes.NewReader(stripped), int64(len(stripped)), attachment.ContentType); err != nil {
+			return fmt.Errorf("%w: %w", errLocationNotStripped, err)
+		}
+		attachment.StorageKey = key
+		attachment.Size = int64(len(stripped))
+		data = stripped
+	}
+
+	info, err := media.ProcessImage(data, thumbnailSize)
+	if err != nil {
+		// Formats without a decoder are served without a preview
+		if errors.Is(err, media.ErrUnsupportedFormat) {
+			return nil
+		}
+		return err
+	}
+
+	thumbnailKey := "thumbnails/" + attachment.ID.String()
+	thumbnail := info.Thumbnail
+	if err := p.store.Put(ctx, thumbnailKey, bytes.NewReader(thumbnail.Data), int64(len(thumbnail.Data)), thumbnail.ContentType); err != nil {
+		return err
+	}
+
+	attachment.Width = &info.Width
+	attachment.Height = &info.Height
+	attachment.Blurhash = info.Blurhash
+	attachment.ThumbnailKey = thumbnailKey
+	attachment.ThumbnailContentType = thumbnail.ContentType
+	attachment.ThumbnailWidth = &thumbnail.Width
+	attachment.ThumbnailHeight = &thumbnail.Height
+	return nil
+}
+
+// processVideo records the duration and size of MP4 videos. Only the headers
+// are read, so large files aren't downloaded in full.
+func (p *mediaProcessor) processVideo(ctx context.Context, attachment *models.Attachment) error {
+	if attachment.ContentType != "video/mp4" {
+		return nil
+	}
+
+	content := storage.NewReadSeeker(ctx, p.store, attachment.StorageKey, attachment.Size)
+	defer content.Close()
+
+	info, err := media.ProbeMP4(content)
+	if err != nil {
+		return err
+	}
+
+	durationMs := info.Duration.Milliseconds()
+	attachment.DurationMs = &durationMs
+	if info.Width > 0 && info.Height > 0 {
+		attachment.Width = &info.Width
+		attachment.Height = &info.Height
+	}
+	return nil
+}
+
+// notify tells the uploader, and releases the attachment's message to the
+// room when it was the last one holding it back. The attachment is read again
+// since it may have been sent in a message while it was processed.
+func (p *mediaProcessor) notify(ctx context.Context, id uuid.UUID) {
+	attachment, err := p.attachmentRepo.FindByID(ctx, id)
+	if err != nil {
+		log.Printf("error loading processed attachment %s: %v", id, err)
+		return
+	}
+
+	p.notifier.AttachmentProcessed(attachment)
+
+	if attachment.MessageID == nil || !attachment.IsCleared() {
+		return
+	}
+
+	message, err := p.messageRepo.FindByID(ctx, *attachment.MessageID)
+	if err != nil {
+		// The message was deleted, so there's nothing to release
+		return
+	}
+	if !message.IsWithheld() {
+		p.notifier.MessageReleased(message)
+	}
+}
+
+func (p *mediaProcessor) readObject(ctx context.Context, key string, size int64) ([]byte, error) {
+	object, err := p.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(object, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (p *mediaProcessor) deleteObject(ctx context.Context, key string) {
+	if err := p.store.Delete(ctx, key); err != nil {
+		log.Printf("error removing %s: %v", key, err)
+	}
+}
@@ -2,19 +2,51 @@ package services
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/kevinsofyan/echoes-chat-api/internal/models"
 	"github.com/kevinsofyan/echoes-chat-api/internal/repositories"
 )
 
+var (
+	ErrMessageNotFound    = errors.New("message not found")
+	ErrContentRequired    = errors.New("content is required")
+	ErrInvalidMessageType = errors.New("type must be text, image, file, video or audio and match the first attachment")
+	ErrNotMessageSender   = errors.New("only the sender can edit this message")
+	ErrInvalidCursor      = errors.New("invalid cursor")
+	ErrConflictingCursor  = errors.New("only one of before, after or around can be used")
+	ErrInvalidAttachment  = errors.New("attachment not found or already sent")
+	ErrTooManyAttachments = errors.New("too many attachments")
+	ErrInvalidReplyTarget = errors.New("message to reply to not found")
+	ErrInvalidReaction    = errors.New("reaction must be a single emoji")
+	ErrTooManyReactions   = errors.New("too many reactions on this message")
+	ErrReactionNotFound   = errors.New("reaction not found")
+)
+
+const (
+	maxMessagePageSize    = 100
+	maxMessageAttachments = 10
+	// maxUserReactions caps the different emoji one user can react to a message with
+	maxUserReactions = 20
+	// maxEmojiLength is in bytes; family and flag sequences take up to about 35
+	maxEmojiLength = 64
+)
+
 type MessageService interface {
 	CreateMessage(ctx context.Context, req CreateMessageRequest) (*models.Message, error)
-	GetMessageByID(ctx context.Context, id uuid.UUID) (*models.Message, error)
-	GetMessagesByRoomID(ctx context.Context, roomID uuid.UUID, limit, offset int) ([]models.Message, error)
-	UpdateMessage(ctx context.Context, id uuid.UUID, req UpdateMessageRequest) (*models.Message, error)
-	DeleteMessage(ctx context.Context, id uuid.UUID) error
+	GetMessageByID(ctx context.Context, id, userID uuid.UUID) (*models.Message, error)
+	GetMessagesByRoomID(ctx context.Context, roomID, userID uuid.UUID, req MessagePageRequest) (*MessagePage, error)
+	UpdateMessage(ctx context.Context, id, userID uuid.UUID, req UpdateMessageRequest) (*models.Message, error)
+	DeleteMessage(ctx context.Context, id, userID uuid.UUID) (*models.Message, error)
+	MarkAsRead(ctx context.Context, roomID, userID uuid.UUID, req MarkReadRequest) (*models.RoomRead, error)
+	AddReaction(ctx context.Context, messageID, userID uuid.UUID, req ReactionRequest) (*ReactionChange, error)
+	RemoveReaction(ctx context.Context, messageID, userID uuid.UUID, req ReactionRequest) (*ReactionChange, error)
 }
 
 type CreateMessageRequest struct {
@@ -24,33 +56,117 @@ type CreateMessageRequest struct {
 	Type      string     `json:"type" validate:"required,oneof=text image file video audio"`
 	FileURL   string     `json:"file_url,omitempty"`
 	ReplyToID *uuid.UUID `json:"reply_to_id,omitempty"`
+	// AttachmentIDs are the sender's uploads to send with the message
+	AttachmentIDs []uuid.UUID `json:"attachment_ids,omitempty"`
 }
 
 type UpdateMessageRequest struct {
 	Content string `json:"content" validate:"required"`
 }
 
+type MarkReadRequest struct {
+	MessageID uuid.UUID `json:"message_id" validate:"required"`
+}
+
+type ReactionRequest struct {
+	Emoji string `json:"emoji" validate:"required"`
+}
+
+// ReactionChange describes a reaction that was added or removed. Count is how
+// many reactions with that emoji the message has afterwards. Changed is false
+// when the user had already reacted with that emoji, so nothing was added.
+type ReactionChange struct {
+	Message  *models.Message
+	Reaction models.MessageReaction
+	Count    int64
+	Changed  bool
+}
+
+// MessagePageRequest selects a page of history using opaque cursors.
+// Before pages towards older messages, After towards newer ones, and Around
+// centers the page on a message (inclusive), e.g. to jump to a reply.
+type MessagePageRequest struct {
+	Before string `query:"before"`
+	After  string `query:"after"`
+	Around string `query:"around"`
+	Limit  int    `query:"limit"`
+}
+
+// MessagePage holds messages newest first along with cursors for the adjacent pages
+type MessagePage struct {
+	Messages    []models.Message `json:"messages"`
+	OlderCursor string           `json:"older_cursor,omitempty"`
+	NewerCursor string           `json:"newer_cursor,omitempty"`
+	HasOlder    bool             `json:"has_older"`
+	HasNewer    bool             `json:"has_newer"`
+}
+
 type messageService struct {
-	messageRepo repositories.MessageRepository
+	messageRepo    repositories.MessageRepository
+	memberRepo     repositories.RoomMemberRepository
+	readRepo       repositories.RoomReadRepository
+	attachmentRepo repositories.AttachmentRepository
+	reactionRepo   repositories.ReactionRepository
 }
 
-func NewMessageService(messageRepo repositories.MessageRepository) MessageService {
+func NewMessageService(
+	messageRepo repositories.MessageRepository,
+	memberRepo repositories.RoomMemberRepository,
+	readRepo repositories.RoomReadRepository,
+	attachmentRepo repositories.AttachmentRepository,
+	reactionRepo repositories.ReactionRepository,
+) MessageService {
 	return &messageService{
-		messageRepo: messageRepo,
+		messageRepo:    messageRepo,
+		memberRepo:     memberRepo,
+		readRepo:       readRepo,
+		attachmentRepo: attachmentRepo,
+		reactionRepo:   reactionRepo,
 	}
 }
 
 func (s *messageService) CreateMessage(ctx context.Context, req CreateMessageRequest) (*models.Message, error) {
+	if _, err := s.requireMember(ctx, req.RoomID, req.SenderID); err != nil {
+		return nil, err
+	}
+
+	// The quoted message is shown with the reply, so it must be one the sender
+	// can see in the same room
+	if req.ReplyToID != nil {
+		target, err := s.messageRepo.FindByID(ctx, *req.ReplyToID)
+		if err != nil || target.RoomID != req.RoomID || (target.IsWithheld() && target.SenderID != req.SenderID) {
+			return nil, ErrInvalidReplyTarget
+		}
+	}
+
+	attachments, err := s.unsentAttachments(ctx, req.SenderID, req.AttachmentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	messageType, err := resolveMessageType(models.MessageType(req.Type), attachments)
+	if err != nil {
+		return nil, err
+	}
+
 	message := &models.Message{
 		RoomID:    req.RoomID,
 		SenderID:  req.SenderID,
 		Content:   req.Content,
-		Type:      models.MessageType(req.Type),
+		Type:      messageType,
 		FileURL:   req.FileURL,
 		ReplyToID: req.ReplyToID,
 	}
 
-	if err := s.messageRepo.Create(ctx, message); err != nil {
+	if len(attachments) > 0 {
+		err = s.messageRepo.CreateWithAttachments(ctx, message, req.AttachmentIDs)
+	} else {
+		err = s.messageRepo.Create(ctx, message)
+	}
+	if err != nil {
+		if errors.Is(err, repositories.ErrAttachmentUnavailable) {
+			return nil, ErrInvalidAttachment
+		}
 		return nil, err
 	}
 
@@ -58,21 +174,147 @@ func (s *messageService) CreateMessage(ctx context.Context, req CreateMessageReq
 	return s.messageRepo.FindByID(ctx, message.ID)
 }
 
-func (s *messageService) GetMessageByID(ctx context.Context, id uuid.UUID) (*models.Message, error) {
-	return s.messageRepo.FindByID(ctx, id)
+func (s *messageService) GetMessageByID(ctx context.Context, id, userID uuid.UUID) (*models.Message, error) {
+	message, err := s.visibleMessage(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	hideWithheldReply(message, userID)
+
+	messages := []models.Message{*message}
+	if err := s.countReactions(ctx, messages, userID); err != nil {
+		return nil, err
+	}
+	message.Reactions = messages[0].Reactions
+
+	return message, nil
 }
 
-func (s *messageService) GetMessagesByRoomID(ctx context.Context, roomID uuid.UUID, limit, offset int) ([]models.Message, error) {
-	if limit == 0 {
+func (s *messageService) GetMessagesByRoomID(ctx context.Context, roomID, userID uuid.UUID, req MessagePageRequest) (*MessagePage, error) {
+	if _, err := s.requireMember(ctx, roomID, userID); err != nil {
+		return nil, err
+	}
+
+	cursors := 0
+	for _, c := range []string{req.Before, req.After, req.Around} {
+		if c != "" {
+			cursors++
+		}
+	}
+	if cursors > 1 {
+		return nil, ErrConflictingCursor
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
 		limit = 50 // Default limit
 	}
-	return s.messageRepo.FindByRoomID(ctx, roomID, limit, offset)
+	if limit > maxMessagePageSize {
+		limit = maxMessagePageSize
+	}
+
+	// Each query fetches one extra row to learn whether more messages exist
+	page := &MessagePage{}
+	switch {
+	case req.Around != "":
+		cursor, err := decodeMessageCursor(req.Around)
+		if err != nil {
+			return nil, err
+		}
+
+		newerLimit := limit / 2
+		olderLimit := limit - newerLimit
+
+		older, err := s.messageRepo.FindByRoomID(ctx, roomID, repositories.MessageQuery{Before: cursor, Inclusive: true, Limit: olderLimit + 1, ViewerID: userID})
+		if err != nil {
+			return nil, err
+		}
+		newer, err := s.messageRepo.FindByRoomID(ctx, roomID, repositories.MessageQuery{After: cursor, Limit: newerLimit + 1, ViewerID: userID})
+		if err != nil {
+			return nil, err
+		}
+
+		page.HasOlder = len(older) > olderLimit
+		if page.HasOlder {
+			older = older[:olderLimit]
+		}
+		page.HasNewer = len(newer) > newerLimit
+		if page.HasNewer {
+			newer = newer[len(newer)-newerLimit:]
+		}
+		page.Messages = append(newer, older...)
+
+	case req.After != "":
+		cursor, err := decodeMessageCursor(req.After)
+		if err != nil {
+			return nil, err
+		}
+
+		newer, err := s.messageRepo.FindByRoomID(ctx, roomID, repositories.MessageQuery{After: cursor, Limit: limit + 1, ViewerID: userID})
+		if err != nil {
+			return nil, err
+		}
+
+		page.HasOlder = true
+		page.HasNewer = len(newer) > limit
+		if page.HasNewer {
+			newer = newer[len(newer)-limit:]
+		}
+		page.Messages = newer
+
+	default:
+		var cursor *repositories.MessageCursor
+		if req.Before != "" {
+			var err error
+			if cursor, err = decodeMessageCursor(req.Before); err != nil {
+				return nil, err
+			}
+		}
+
+		older, err := s.messageRepo.FindByRoomID(ctx, roomID, repositories.MessageQuery{Before: cursor, Limit: limit + 1, ViewerID: userID})
+		if err != nil {
+			return nil, err
+		}
+
+		page.HasNewer = cursor != nil
+		page.HasOlder = len(older) > limit
+		if page.HasOlder {
+			older = older[:limit]
+		}
+		page.Messages = older
+	}
+
+	if len(page.Messages) > 0 {
+		page.NewerCursor = EncodeMessageCursor(&page.Messages[0])
+		page.OlderCursor = EncodeMessageCursor(&page.Messages[len(page.Messages)-1])
+	}
+
+	for i := range page.Messages {
+		hideWithheldReply(&page.Messages[i], userID)
+	}
+	if err := s.countReactions(ctx, page.Messages, userID); err != nil {
+		return nil, err
+	}
+
+	return page, nil
 }
 
-func (s *messageService) UpdateMessage(ctx context.Context, id uuid.UUID, req UpdateMessageRequest) (*models.Message, error) {
+func (s *messageService) UpdateMessage(ctx context.Context, id, userID uuid.UUID, req UpdateMessageRequest) (*models.Message, error) {
+	if req.Content == "" {
+		return nil, ErrContentRequired
+	}
+
 	message, err := s.messageRepo.FindByID(ctx, id)
 	if err != nil {
-		return nil, errors.New("message not found")
+		return nil, ErrMessageNotFound
+	}
+
+	if _, err := s.requireMember(ctx, message.RoomID, userID); err != nil {
+		return nil, err
+	}
+
+	if message.SenderID != userID {
+		return nil, ErrNotMessageSender
 	}
 
 	message.Content = req.Content
@@ -81,10 +323,317 @@ func (s *messageService) UpdateMessage(ctx context.Context, id uuid.UUID, req Up
 	if err := s.messageRepo.Update(ctx, message); err != nil {
 		return nil, err
 	}
+	hideWithheldReply(message, userID)
 
 	return message, nil
 }
 
-func (s *messageService) DeleteMessage(ctx context.Context, id uuid.UUID) error {
-	return s.messageRepo.Delete(ctx, id)
+// DeleteMessage removes a message sent by the user, or any message in a room the user administers.
+// The deleted message is returned so callers can notify the room.
+func (s *messageService) DeleteMessage(ctx context.Context, id, userID uuid.UUID) (*models.Message, error) {
+	message, err := s.messageRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	member, err := s.requireMember(ctx, message.RoomID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if message.SenderID != userID && member.Role.Rank() < models.RoleAdmin.Rank() {
+		return nil, ErrInsufficientRole
+	}
+
+	if err := s.messageRepo.Delete(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// MarkAsRead moves the user's read position in the room up to the given message.
+// It returns the stored position, which is unchanged if a later message was already read.
+func (s *messageService) MarkAsRead(ctx context.Context, roomID, userID uuid.UUID, req MarkReadRequest) (*models.RoomRead, error) {
+	if _, err := s.requireMember(ctx, roomID, userID); err != nil {
+		return nil, err
+	}
+
+	message, err := s.messageRepo.FindByID(ctx, req.MessageID)
+	if err != nil || message.RoomID != roomID || (message.IsWithheld() && message.SenderID != userID) {
+		return nil, ErrMessageNotFound
+	}
+
+	read := &models.RoomRead{
+		RoomID:            roomID,
+		UserID:            userID,
+		LastReadMessageID: message.ID,
+		LastReadAt:        message.CreatedAt,
+	}
+
+	if err := s.readRepo.Upsert(ctx, read); err != nil {
+		return nil, err
+	}
+
+	return s.readRepo.FindByRoomAndUser(ctx, roomID, userID)
+}
+
+// AddReaction reacts to a message the user can see with an emoji.
+// Reacting again with the same emoji changes nothing.
+func (s *messageService) AddReaction(ctx context.Context, messageID, userID uuid.UUID, req ReactionRequest) (*ReactionChange, error) {
+	if !isEmoji(req.Emoji) {
+		return nil, ErrInvalidReaction
+	}
+
+	message, err := s.visibleMessage(ctx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	reaction := models.MessageReaction{
+		MessageID: messageID,
+		UserID:    userID,
+		Emoji:     req.Emoji,
+	}
+
+	// Only a new emoji counts against the cap
+	exists, err := s.reactionRepo.Exists(ctx, messageID, userID, req.Emoji)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return s.reactionChange(ctx, message, reaction, false)
+	}
+
+	reacted, err := s.reactionRepo.CountByUser(ctx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if reacted >= maxUserReactions {
+		return nil, ErrTooManyReactions
+	}
+
+	added, err := s.reactionRepo.Add(ctx, &reaction)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.reactionChange(ctx, message, reaction, added)
+}
+
+// RemoveReaction takes back the user's reaction to a message with an emoji
+func (s *messageService) RemoveReaction(ctx context.Context, messageID, userID uuid.UUID, req ReactionRequest) (*ReactionChange, error) {
+	message, err := s.visibleMessage(ctx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	removed, err := s.reactionRepo.Remove(ctx, messageID, userID, req.Emoji)
+	if err != nil {
+		return nil, err
+	}
+	if !removed {
+		return nil, ErrReactionNotFound
+	}
+
+	return s.reactionChange(ctx, message, models.MessageReaction{
+		MessageID: messageID,
+		UserID:    userID,
+		Emoji:     req.Emoji,
+	}, true)
+}
+
+// visibleMessage loads a message the user can see: one in a room they are a
+// member of, that isn't withheld from them
+func (s *messageService) visibleMessage(ctx context.Context, id, userID uuid.UUID) (*models.Message, error) {
+	message, err := s.messageRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	if _, err := s.requireMember(ctx, message.RoomID, userID); err != nil {
+		return nil, err
+	}
+
+	if message.IsWithheld() && message.SenderID != userID {
+		return nil, ErrMessageNotFound
+	}
+
+	return message, nil
+}
+
+func (s *messageService) reactionChange(ctx context.Context, message *models.Message, reaction models.MessageReaction, changed bool) (*ReactionChange, error) {
+	count, err := s.reactionRepo.CountByEmoji(ctx, message.ID, reaction.Emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReactionChange{
+		Message:  message,
+		Reaction: reaction,
+		Count:    count,
+		Changed:  changed,
+	}, nil
+}
+
+// countReactions fills in the reactions on each message as seen by the viewer
+func (s *messageService) countReactions(ctx context.Context, messages []models.Message, viewerID uuid.UUID) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+	}
+
+	counts, err := s.reactionRepo.CountByMessageIDs(ctx, ids, viewerID)
+	if err != nil {
+		return err
+	}
+
+	byMessage := make(map[uuid.UUID][]models.ReactionCount)
+	for _, count := range counts {
+		byMessage[count.MessageID] = append(byMessage[count.MessageID], count)
+	}
+	for i := range messages {
+		messages[i].Reactions = byMessage[messages[i].ID]
+	}
+	return nil
+}
+
+// isEmoji loosely checks that a reaction is one emoji. Emoji can be sequences
+// of several code points (skin tones, joined families, flags and keycaps), so
+// rather than matching a list, it accepts short runs of symbols and the marks
+// and joiners that combine them, and rejects text and whitespace.
+func isEmoji(emoji string) bool {
+	if emoji == "" || len(emoji) > maxEmojiLength || !utf8.ValidString(emoji) {
+		return false
+	}
+
+	symbol := false
+	for _, r := range emoji {
+		switch {
+		case unicode.Is(unicode.So, r), unicode.Is(unicode.Me, r):
+			// Pictographs, flag letters and the keycap mark
+			symbol = true
+		case unicode.Is(unicode.Sk, r), unicode.Is(unicode.Mn, r):
+			// Skin tone modifiers and variation selectors
+		case r == '\u200d', r >= 0xe0020 && r <= 0xe007f:
+			// Zero width joiners, and the tags of subdivision flags
+		case r == '#', r == '*', r >= '0' && r <= '9':
+			// Keycap bases
+		default:
+			return false
+		}
+	}
+	return symbol
+}
+
+// hideWithheldReply drops the quoted message from a reply when the viewer
+// can't see it. Replies are only accepted to visible messages in the same room,
+// but the quoted message may be withheld from everyone else while its sender
+// replies to it. Its ID is kept, as it reveals nothing.
+func hideWithheldReply(message *models.Message, viewerID uuid.UUID) {
+	reply := message.ReplyTo
+	if reply == nil {
+		return
+	}
+	if reply.RoomID != message.RoomID || (reply.IsWithheld() && reply.SenderID != viewerID) {
+		message.ReplyTo = nil
+	}
+}
+
+// unsentAttachments loads the sender's attachments that haven't been sent with a message yet
+// resolveMessageType checks an explicit type against the message's attachments.
+// Without one, a message is typed after its first attachment.
+func resolveMessageType(requested models.MessageType, attachments []models.Attachment) (models.MessageType, error) {
+	switch requested {
+	case "":
+		if len(attachments) > 0 {
+			return attachments[0].Kind(), nil
+		}
+		return models.MessageTypeText, nil
+	case models.MessageTypeText, models.MessageTypeImage, models.MessageTypeFile, models.MessageTypeVideo, models.MessageTypeAudio:
+		if len(attachments) > 0 && attachments[0].Kind() != requested {
+			return "", ErrInvalidMessageType
+		}
+		return requested, nil
+	default:
+		return "", ErrInvalidMessageType
+	}
+}
+
+func (s *messageService) unsentAttachments(ctx context.Context, senderID uuid.UUID, ids []uuid.UUID) ([]models.Attachment, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if len(ids) > maxMessageAttachments {
+		return nil, ErrTooManyAttachments
+	}
+
+	found, err := s.attachmentRepo.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uuid.UUID]models.Attachment, len(found))
+	for _, attachment := range found {
+		byID[attachment.ID] = attachment
+	}
+
+	// Keep the requested order, which decides the message type
+	attachments := make([]models.Attachment, 0, len(ids))
+	for _, id := range ids {
+		attachment, ok := byID[id]
+		if !ok || attachment.UploaderID != senderID || attachment.MessageID != nil {
+			return nil, ErrInvalidAttachment
+		}
+		attachments = append(attachments, attachment)
+		// Repeated IDs would otherwise count twice against the linked rows
+		delete(byID, id)
+	}
+
+	return attachments, nil
+}
+
+// requireMember returns the user's membership in the room, or ErrNotRoomMember
+func (s *messageService) requireMember(ctx context.Context, roomID, userID uuid.UUID) (*models.RoomMember, error) {
+	member, err := s.memberRepo.FindByRoomAndUser(ctx, roomID, userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrMemberNotFound) {
+			return nil, ErrNotRoomMember
+		}
+		return nil, err
+	}
+	return member, nil
+}
+
+// EncodeMessageCursor returns an opaque cursor pointing at the message's position in its room
+func EncodeMessageCursor(message *models.Message) string {
+	raw := message.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + message.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeMessageCursor(cursor string) (*repositories.MessageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	messageID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &repositories.MessageCursor{CreatedAt: t, ID: messageID}, nil
 }
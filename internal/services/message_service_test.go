@@ -0,0 +1,88 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+)
+
+func TestMessageCursorRoundTrip(t *testing.T) {
+	message := &models.Message{
+		BaseModel: models.BaseModel{
+			ID:        uuid.New(),
+			CreatedAt: time.Date(2024, 3, 1, 12, 30, 45, 123456789, time.FixedZone("UTC+7", 7*60*60)),
+		},
+	}
+
+	cursor, err := decodeMessageCursor(EncodeMessageCursor(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.ID != message.ID {
+		t.Errorf("got ID %s, want %s", cursor.ID, message.ID)
+	}
+	// Nanoseconds must survive, or messages created in the same second are skipped
+	if !cursor.CreatedAt.Equal(message.CreatedAt) {
+		t.Errorf("got time %s, want %s", cursor.CreatedAt, message.CreatedAt)
+	}
+}
+
+func TestDecodeMessageCursorRejectsInvalidCursors(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+
+	tests := map[string]string{
+		"not base64":   "!!!",
+		"no separator": encode("2024-03-01T12:30:45Z"),
+		"bad time":     encode("yesterday|" + uuid.NewString()),
+		"bad ID":       encode("2024-03-01T12:30:45Z|not-a-uuid"),
+		"empty":        "",
+	}
+	for name, cursor := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := decodeMessageCursor(cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("got %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestResolveMessageType(t *testing.T) {
+	image := []models.Attachment{{ContentType: "image/png"}}
+	pdf := []models.Attachment{{ContentType: "application/pdf"}}
+
+	tests := []struct {
+		name        string
+		requested   models.MessageType
+		attachments []models.Attachment
+		want        models.MessageType
+		wantErr     bool
+	}{
+		{name: "default text", want: models.MessageTypeText},
+		{name: "default from attachment", attachments: image, want: models.MessageTypeImage},
+		{name: "explicit text", requested: models.MessageTypeText, want: models.MessageTypeText},
+		{name: "matching attachment", requested: models.MessageTypeFile, attachments: pdf, want: models.MessageTypeFile},
+		{name: "mismatched attachment", requested: models.MessageTypeVideo, attachments: image, wantErr: true},
+		{name: "text with attachment", requested: models.MessageTypeText, attachments: pdf, wantErr: true},
+		{name: "unknown type", requested: "sticker", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveMessageType(tt.requested, tt.attachments)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidMessageType) {
+					t.Errorf("got %q, %v; want ErrInvalidMessageType", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
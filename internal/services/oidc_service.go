@@ -0,0 +1,291 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"github.com/kevinsofyan/echoes-chat-api/internal/oidc"
+	"github.com/kevinsofyan/echoes-chat-api/internal/repositories"
+	"github.com/kevinsofyan/echoes-chat-api/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type OIDCService interface {
+	// Providers lists the configured provider names
+	Providers() []string
+	// BeginLogin creates the state for a login and returns where to send the user
+	BeginLogin(ctx context.Context, provider string) (*OIDCLogin, error)
+	// CompleteLogin handles the provider's callback, linking or provisioning the user
+	CompleteLogin(ctx context.Context, provider string, req OIDCCallbackRequest, device SessionMetadata) (*LoginResult, error)
+}
+
+// OIDCLogin is returned when a login starts. State must come back with the
+// callback from the same browser.
+type OIDCLogin struct {
+	AuthURL   string
+	State     string
+	ExpiresIn int64
+}
+
+type OIDCCallbackRequest struct {
+	State string `query:"state"`
+	Code  string `query:"code"`
+}
+
+var (
+	ErrUnknownOIDCProvider   = errors.New("unknown identity provider")
+	ErrInvalidOIDCState      = errors.New("invalid or expired login state")
+	ErrOIDCLoginFailed       = errors.New("identity provider login failed")
+	ErrOIDCEmailNotVerified  = errors.New("identity provider has not verified this email")
+	ErrOIDCAccountLinked     = errors.New("account is already linked to another identity at this provider")
+	ErrOIDCAccountUnverified = errors.New("an account with this email exists but its email is not verified; verify it or sign in with your password first")
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+var usernameDisallowed = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+type oidcService struct {
+	providers    map[string]*oidc.Provider
+	names        []string
+	userRepo     repositories.UserRepository
+	identityRepo repositories.OIDCIdentityRepository
+	stateRepo    repositories.OIDCLoginStateRepository
+	authService  AuthService
+}
+
+func NewOIDCService(
+	configs []oidc.Config,
+	userRepo repositories.UserRepository,
+	identityRepo repositories.OIDCIdentityRepository,
+	stateRepo repositories.OIDCLoginStateRepository,
+	authService AuthService,
+) OIDCService {
+	s := &oidcService{
+		providers:    make(map[string]*oidc.Provider),
+		names:        []string{},
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		stateRepo:    stateRepo,
+		authService:  authService,
+	}
+	for _, config := range configs {
+		s.providers[config.Name] = oidc.NewProvider(config)
+		s.names = append(s.names, config.Name)
+	}
+	return s
+}
+
+func (s *oidcService) Providers() []string {
+	return s.names
+}
+
+func (s *oidcService) BeginLogin(ctx context.Context, provider string) (*OIDCLogin, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+
+	state, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := p.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		log.Printf("error starting %s login: %v", provider, err)
+		return nil, ErrOIDCLoginFailed
+	}
+
+	loginState := &models.OIDCLoginState{
+		Provider:     provider,
+		StateHash:    utils.HashToken(state),
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}
+	if err := s.stateRepo.Create(ctx, loginState); err != nil {
+		return nil, err
+	}
+
+	return &OIDCLogin{
+		AuthURL:   authURL,
+		State:     state,
+		ExpiresIn: int64(oidcStateTTL.Seconds()),
+	}, nil
+}
+
+func (s *oidcService) CompleteLogin(ctx context.Context, provider string, req OIDCCallbackRequest, device SessionMetadata) (*LoginResult, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+
+	loginState, err := s.stateRepo.FindValidByHash(ctx, provider, utils.HashToken(req.State))
+	if err != nil {
+		if errors.Is(err, repositories.ErrLoginStateNotFound) {
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, err
+	}
+
+	consumed, err := s.stateRepo.MarkUsed(ctx, loginState.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, ErrInvalidOIDCState
+	}
+
+	claims, err := p.Exchange(ctx, req.Code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("error completing %s login: %v", provider, err)
+		return nil, ErrOIDCLoginFailed
+	}
+
+	user, err := s.resolveUser(ctx, provider, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.authService.LoginVerified(ctx, user, device)
+}
+
+// resolveUser finds the user linked to the provider's subject. On first login
+// the identity is linked to the account with the same email, or a new account
+// is created; either way only for emails the provider has verified. Accounts
+// whose own email isn't verified yet are never linked.
+func (s *oidcService) resolveUser(ctx context.Context, provider string, claims *oidc.Claims) (*models.User, error) {
+	identity, err := s.identityRepo.FindBySubject(ctx, provider, claims.Subject)
+	if err == nil {
+		return s.userRepo.FindByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, repositories.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	user, err := s.userRepo.FindByEmail(ctx, claims.Email)
+	if err != nil {
+		if user, err = s.provisionUser(ctx, claims); err != nil {
+			return nil, err
+		}
+	} else {
+		// A different subject with the same email is a different person at the provider
+		if _, err := s.identityRepo.FindByUserID(ctx, provider, user.ID); err == nil {
+			return nil, ErrOIDCAccountLinked
+		} else if !errors.Is(err, repositories.ErrIdentityNotFound) {
+			return nil, err
+		}
+
+		// Anyone can register with an email they don't own, so an unverified
+		// account may belong to someone else. Linking it would hand them the
+		// SSO user's identity, while their password keeps working.
+		if user.EmailVerifiedAt == nil {
+			return nil, ErrOIDCAccountUnverified
+		}
+	}
+
+	identity = &models.OIDCIdentity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+	if err := s.identityRepo.Create(ctx, identity); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// provisionUser creates an account for a first-time SSO user. It has a random
+// password; the user can set one through the password reset flow.
+func (s *oidcService) provisionUser(ctx context.Context, claims *oidc.Claims) (*models.User, error) {
+	username, err := s.availableUsername(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, errors.New("failed to hash password")
+	}
+
+	now := time.Now()
+	user := &models.User{
+		Username:        username,
+		Email:           claims.Email,
+		Password:        string(hashedPassword),
+		FullName:        truncate(claims.Name, 100),
+		EmailVerifiedAt: &now,
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// availableUsername derives a username from the provider's preferred_username
+// or the email's local part, adding a random suffix when it is taken
+func (s *oidcService) availableUsername(ctx context.Context, claims *oidc.Claims) (string, error) {
+	base := claims.PreferredUsername
+	if i := strings.Index(base, "@"); i >= 0 {
+		base = base[:i]
+	}
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = truncate(usernameDisallowed.ReplaceAllString(base, ""), 40)
+	if len(base) < 3 {
+		base = "user"
+	}
+
+	candidate := base
+	for attempt := 0; attempt < 5; attempt++ {
+		if _, err := s.userRepo.FindByUsername(ctx, candidate); err != nil {
+			return candidate, nil
+		}
+
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+		candidate = base + "-" + hex.EncodeToString(suffix)
+	}
+
+	return "", fmt.Errorf("no available username for %q", base)
+}
+
+// truncate shortens value to at most max characters
+func truncate(value string, max int) string {
+	runes := []rune(value)
+	if len(runes) <= max {
+		return value
+	}
+	return string(runes[:max])
+}
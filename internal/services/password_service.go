@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/mailer"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"github.com/kevinsofyan/echoes-chat-api/internal/repositories"
+	"github.com/kevinsofyan/echoes-chat-api/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrIncorrectPassword = errors.New("current password is incorrect")
+	ErrWeakPassword      = errors.New("password must be at least 6 characters")
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+)
+
+const (
+	minPasswordLength = 6
+	resetTokenTTL     = time.Hour
+)
+
+type PasswordService interface {
+	// ChangePassword requires the current password and signs out every other session
+	ChangePassword(ctx context.Context, userID, sessionID uuid.UUID, req ChangePasswordRequest) error
+	// ForgotPassword emails a reset link in the background. It succeeds for
+	// unknown addresses too, so the endpoint can't be used to find out who has
+	// an account. Requests are throttled per address and per ipAddress.
+	ForgotPassword(ctx context.Context, req ForgotPasswordRequest, ipAddress string) error
+	// ResetPassword sets a new password and signs out every session
+	ResetPassword(ctx context.Context, req ResetPasswordRequest) error
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=6"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=6"`
+}
+
+type passwordService struct {
+	userRepo    repositories.UserRepository
+	resetRepo   repositories.PasswordResetRepository
+	authService AuthService
+	mailer      mailer.Mailer
+	throttle    MailThrottle
+}
+
+func NewPasswordService(
+	userRepo repositories.UserRepository,
+	resetRepo repositories.PasswordResetRepository,
+	authService AuthService,
+	mailer mailer.Mailer,
+	throttle MailThrottle,
+) PasswordService {
+	return &passwordService{
+		userRepo:    userRepo,
+		resetRepo:   resetRepo,
+		authService: authService,
+		mailer:      mailer,
+		throttle:    throttle,
+	}
+}
+
+func (s *passwordService) ChangePassword(ctx context.Context, userID, sessionID uuid.UUID, req ChangePasswordRequest) error {
+	if len(req.NewPassword) < minPasswordLength {
+		return ErrWeakPassword
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		return ErrIncorrectPassword
+	}
+
+	if err := s.setPassword(ctx, userID, req.NewPassword); err != nil {
+		return err
+	}
+
+	return s.authService.RevokeOtherSessions(ctx, userID, sessionID)
+}
+
+func (s *passwordService) ForgotPassword(ctx context.Context, req ForgotPasswordRequest, ipAddress string) error {
+	if err := s.throttle.Reserve(ctx, req.Email, ipAddress); err != nil {
+		return err
+	}
+
+	sendInBackground("password reset email", func(ctx context.Context) error {
+		return s.sendReset(ctx, req.Email)
+	})
+	return nil
+}
+
+func (s *passwordService) sendReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return errors.New("failed to generate token")
+	}
+
+	reset := &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(resetTokenTTL),
+	}
+
+	if err := s.resetRepo.Create(ctx, reset); err != nil {
+		return errors.New("failed to store token")
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the link below to choose a new password. It expires in %d minutes.\n\n%s\n\nIf you didn't ask to reset your password, you can ignore this email.\n",
+			user.Username, int(resetTokenTTL.Minutes()), tokenLink("PASSWORD_RESET_URL", token),
+		),
+	})
+}
+
+func (s *passwordService) ResetPassword(ctx context.Context, req ResetPasswordRequest) error {
+	if len(req.NewPassword) < minPasswordLength {
+		return ErrWeakPassword
+	}
+
+	reset, err := s.resetRepo.FindValidByHash(ctx, utils.HashToken(req.Token))
+	if err != nil {
+		if errors.Is(err, repositories.ErrResetTokenNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	consumed, err := s.resetRepo.MarkUsed(ctx, reset.ID)
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return ErrInvalidResetToken
+	}
+
+	if err := s.setPassword(ctx, reset.UserID, req.NewPassword); err != nil {
+		return err
+	}
+
+	// Any other links that were sent are no longer needed
+	if err := s.resetRepo.InvalidateByUserID(ctx, reset.UserID); err != nil {
+		log.Printf("error invalidating reset tokens for user %s: %v", reset.UserID, err)
+	}
+
+	// Whoever knew the old password may still be signed in, so end every session
+	return s.authService.RevokeOtherSessions(ctx, reset.UserID, uuid.Nil)
+}
+
+func (s *passwordService) setPassword(ctx context.Context, userID uuid.UUID, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.New("failed to hash password")
+	}
+
+	return s.userRepo.UpdatePassword(ctx, userID, string(hashedPassword))
+}
+
+// tokenLink appends the token to the client page configured in envKey.
+// Without one, the bare token is sent.
+func tokenLink(envKey, token string) string {
+	base := os.Getenv(envKey)
+	if base == "" {
+		return token
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return token
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
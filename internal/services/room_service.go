@@ -2,43 +2,123 @@ package services
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/kevinsofyan/echoes-chat-api/internal/models"
 	"github.com/kevinsofyan/echoes-chat-api/internal/repositories"
 )
 
+var (
+	ErrRoomNotFound       = errors.New("room not found")
+	ErrNotRoomMember      = errors.New("you are not a member of this room")
+	ErrInsufficientRole   = errors.New("you do not have permission to do this in this room")
+	ErrMemberNotFound     = errors.New("user is not a member of this room")
+	ErrAlreadyRoomMember  = errors.New("user is already a member of this room")
+	ErrOwnerCannotLeave   = errors.New("owner must transfer ownership before leaving the room")
+	ErrDirectRoomMembers  = errors.New("direct room membership cannot be changed")
+	ErrInvalidDirectRoom  = errors.New("direct rooms require exactly one other member")
+	ErrInvalidRoomType    = errors.New("type must be either direct or group")
+	ErrInvalidMemberRole  = errors.New("role must be either member or admin")
+	ErrCannotTargetSelf   = errors.New("you cannot perform this action on yourself")
+	ErrAlreadyRoomOwner   = errors.New("user already owns this room")
+	ErrMemberUserRequired = errors.New("user_id is required")
+	ErrUserNotFound       = errors.New("user not found")
+)
+
 type RoomService interface {
 	CreateRoom(ctx context.Context, req CreateRoomRequest) (*models.Room, error)
-	GetRoomByID(ctx context.Context, id uuid.UUID) (*models.Room, error)
-	GetUserRooms(ctx context.Context, userID uuid.UUID) ([]models.Room, error)
+	GetRoomByID(ctx context.Context, id, userID uuid.UUID) (*models.Room, error)
+	GetUserRooms(ctx context.Context, userID uuid.UUID) ([]models.RoomSummary, error)
+	GetUserRoomIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+	GetMembers(ctx context.Context, roomID, actorID uuid.UUID) ([]models.RoomMember, error)
+	AddMember(ctx context.Context, roomID, actorID uuid.UUID, req AddMemberRequest) (*models.RoomMember, error)
+	RemoveMember(ctx context.Context, roomID, actorID, userID uuid.UUID) error
+	LeaveRoom(ctx context.Context, roomID, userID uuid.UUID) error
+	UpdateMemberRole(ctx context.Context, roomID, actorID, userID uuid.UUID, req UpdateMemberRoleRequest) (*models.RoomMember, error)
+	TransferOwnership(ctx context.Context, roomID, actorID, newOwnerID uuid.UUID) error
 }
 
 type CreateRoomRequest struct {
-	Name        string    `json:"name" validate:"required"`
-	Type        string    `json:"type" validate:"required,oneof=direct group"`
-	Description string    `json:"description"`
-	CreatedBy   uuid.UUID `json:"created_by"`
+	Name        string      `json:"name" validate:"required"`
+	Type        string      `json:"type" validate:"required,oneof=direct group"`
+	Description string      `json:"description"`
+	MemberIDs   []uuid.UUID `json:"member_ids"`
+	CreatedBy   uuid.UUID   `json:"created_by"`
+}
+
+type AddMemberRequest struct {
+	UserID uuid.UUID `json:"user_id" validate:"required"`
+}
+
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=member admin"`
 }
 
 type roomService struct {
-	roomRepo repositories.RoomRepository
+	roomRepo   repositories.RoomRepository
+	memberRepo repositories.RoomMemberRepository
+	userRepo   repositories.UserRepository
 }
 
-func NewRoomService(roomRepo repositories.RoomRepository) RoomService {
+func NewRoomService(roomRepo repositories.RoomRepository, memberRepo repositories.RoomMemberRepository, userRepo repositories.UserRepository) RoomService {
 	return &roomService{
-		roomRepo: roomRepo,
+		roomRepo:   roomRepo,
+		memberRepo: memberRepo,
+		userRepo:   userRepo,
 	}
 }
 
 func (s *roomService) CreateRoom(ctx context.Context, req CreateRoomRequest) (*models.Room, error) {
+	roomType := models.RoomType(req.Type)
+	if roomType != models.RoomTypeDirect && roomType != models.RoomTypeGroup {
+		return nil, ErrInvalidRoomType
+	}
+
+	memberIDs := make([]uuid.UUID, 0, len(req.MemberIDs))
+	seen := map[uuid.UUID]bool{req.CreatedBy: true}
+	for _, id := range req.MemberIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		memberIDs = append(memberIDs, id)
+	}
+
+	if roomType == models.RoomTypeDirect && len(memberIDs) != 1 {
+		return nil, ErrInvalidDirectRoom
+	}
+
+	for _, id := range memberIDs {
+		if err := s.requireUser(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	members := []models.RoomMember{{
+		UserID:   req.CreatedBy,
+		Role:     models.RoleOwner,
+		JoinedAt: now,
+	}}
+	for _, id := range memberIDs {
+		members = append(members, models.RoomMember{
+			UserID:   id,
+			Role:     models.RoleMember,
+			JoinedAt: now,
+		})
+	}
+
 	room := &models.Room{
 		Name:        req.Name,
-		Type:        models.RoomType(req.Type),
+		Type:        roomType,
 		Description: req.Description,
 		CreatedBy:   req.CreatedBy,
+		Members:     members,
 	}
 
+	// Members are inserted in the same transaction as the room
 	if err := s.roomRepo.Create(ctx, room); err != nil {
 		return nil, err
 	}
@@ -46,10 +126,191 @@ func (s *roomService) CreateRoom(ctx context.Context, req CreateRoomRequest) (*m
 	return s.roomRepo.FindByID(ctx, room.ID)
 }
 
-func (s *roomService) GetRoomByID(ctx context.Context, id uuid.UUID) (*models.Room, error) {
-	return s.roomRepo.FindByID(ctx, id)
+func (s *roomService) GetRoomByID(ctx context.Context, id, userID uuid.UUID) (*models.Room, error) {
+	room, _, err := s.authorize(ctx, id, userID, models.RoleMember)
+	if err != nil {
+		return nil, err
+	}
+	return room, nil
 }
 
-func (s *roomService) GetUserRooms(ctx context.Context, userID uuid.UUID) ([]models.Room, error) {
+func (s *roomService) GetUserRooms(ctx context.Context, userID uuid.UUID) ([]models.RoomSummary, error) {
 	return s.roomRepo.FindByUserID(ctx, userID)
 }
+
+func (s *roomService) GetUserRoomIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	return s.roomRepo.FindIDsByUserID(ctx, userID)
+}
+
+func (s *roomService) GetMembers(ctx context.Context, roomID, actorID uuid.UUID) ([]models.RoomMember, error) {
+	if _, _, err := s.authorize(ctx, roomID, actorID, models.RoleMember); err != nil {
+		return nil, err
+	}
+
+	return s.memberRepo.FindByRoomID(ctx, roomID)
+}
+
+func (s *roomService) AddMember(ctx context.Context, roomID, actorID uuid.UUID, req AddMemberRequest) (*models.RoomMember, error) {
+	if req.UserID == uuid.Nil {
+		return nil, ErrMemberUserRequired
+	}
+
+	room, _, err := s.authorize(ctx, roomID, actorID, models.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if room.Type == models.RoomTypeDirect {
+		return nil, ErrDirectRoomMembers
+	}
+
+	if err := s.requireUser(ctx, req.UserID); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.memberRepo.FindByRoomAndUser(ctx, roomID, req.UserID); err == nil {
+		return nil, ErrAlreadyRoomMember
+	} else if !errors.Is(err, repositories.ErrMemberNotFound) {
+		return nil, err
+	}
+
+	member := &models.RoomMember{
+		RoomID:   roomID,
+		UserID:   req.UserID,
+		Role:     models.RoleMember,
+		JoinedAt: time.Now(),
+	}
+
+	if err := s.memberRepo.Create(ctx, member); err != nil {
+		return nil, err
+	}
+
+	return member, nil
+}
+
+func (s *roomService) RemoveMember(ctx context.Context, roomID, actorID, userID uuid.UUID) error {
+	if actorID == userID {
+		return ErrCannotTargetSelf
+	}
+
+	room, actor, err := s.authorize(ctx, roomID, actorID, models.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if room.Type == models.RoomTypeDirect {
+		return ErrDirectRoomMembers
+	}
+
+	target, err := s.findMember(ctx, roomID, userID)
+	if err != nil {
+		return err
+	}
+
+	// Admins can only remove regular members; the owner can remove anyone
+	if actor.Role.Rank() <= target.Role.Rank() {
+		return ErrInsufficientRole
+	}
+
+	return s.memberRepo.Delete(ctx, roomID, userID)
+}
+
+func (s *roomService) LeaveRoom(ctx context.Context, roomID, userID uuid.UUID) error {
+	_, member, err := s.authorize(ctx, roomID, userID, models.RoleMember)
+	if err != nil {
+		return err
+	}
+
+	if member.Role == models.RoleOwner {
+		return ErrOwnerCannotLeave
+	}
+
+	return s.memberRepo.Delete(ctx, roomID, userID)
+}
+
+func (s *roomService) UpdateMemberRole(ctx context.Context, roomID, actorID, userID uuid.UUID, req UpdateMemberRoleRequest) (*models.RoomMember, error) {
+	role := models.RoomMemberRole(req.Role)
+	if role != models.RoleMember && role != models.RoleAdmin {
+		return nil, ErrInvalidMemberRole
+	}
+	if actorID == userID {
+		return nil, ErrCannotTargetSelf
+	}
+
+	if _, _, err := s.authorize(ctx, roomID, actorID, models.RoleOwner); err != nil {
+		return nil, err
+	}
+
+	target, err := s.findMember(ctx, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.memberRepo.UpdateRole(ctx, roomID, userID, role); err != nil {
+		return nil, err
+	}
+
+	target.Role = role
+	return target, nil
+}
+
+func (s *roomService) TransferOwnership(ctx context.Context, roomID, actorID, newOwnerID uuid.UUID) error {
+	if actorID == newOwnerID {
+		return ErrAlreadyRoomOwner
+	}
+
+	if _, _, err := s.authorize(ctx, roomID, actorID, models.RoleOwner); err != nil {
+		return err
+	}
+
+	if _, err := s.findMember(ctx, roomID, newOwnerID); err != nil {
+		return err
+	}
+
+	return s.memberRepo.TransferOwnership(ctx, roomID, actorID, newOwnerID)
+}
+
+// authorize loads the room and the actor's membership, and checks the actor holds at least minRole
+func (s *roomService) authorize(ctx context.Context, roomID, actorID uuid.UUID, minRole models.RoomMemberRole) (*models.Room, *models.RoomMember, error) {
+	room, err := s.roomRepo.FindByID(ctx, roomID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrRoomNotFound) {
+			return nil, nil, ErrRoomNotFound
+		}
+		return nil, nil, err
+	}
+
+	member, err := s.memberRepo.FindByRoomAndUser(ctx, roomID, actorID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrMemberNotFound) {
+			return nil, nil, ErrNotRoomMember
+		}
+		return nil, nil, err
+	}
+
+	if member.Role.Rank() < minRole.Rank() {
+		return nil, nil, ErrInsufficientRole
+	}
+
+	return room, member, nil
+}
+
+// requireUser returns ErrUserNotFound unless the user exists
+func (s *roomService) requireUser(ctx context.Context, userID uuid.UUID) error {
+	if _, err := s.userRepo.FindByID(ctx, userID); err != nil {
+		if errors.Is(err, repositories.ErrUserNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *roomService) findMember(ctx context.Context, roomID, userID uuid.UUID) (*models.RoomMember, error) {
+	member, err := s.memberRepo.FindByRoomAndUser(ctx, roomID, userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrMemberNotFound) {
+			return nil, ErrMemberNotFound
+		}
+		return nil, err
+	}
+	return member, nil
+}
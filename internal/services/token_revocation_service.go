@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/repositories"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+const (
+	// activeTokenCacheTTL bounds how long a token revoked by another instance keeps working here.
+	// Revocations made through this service take effect immediately.
+	activeTokenCacheTTL = 30 * time.Second
+	// revokedTokenCacheTTL only needs to outlive the token itself
+	revokedTokenCacheTTL = 24 * time.Hour
+	maxTokenCacheEntries = 10000
+)
+
+// SessionTerminator closes live connections that were authenticated with a revoked token.
+// The websocket hub implements it; it is declared here so services don't depend on the hub.
+type SessionTerminator interface {
+	TerminateTokenSessions(tokenID uuid.UUID)
+	TerminateSession(sessionID uuid.UUID)
+	TerminateUserSessions(userID uuid.UUID)
+}
+
+type TokenRevocationService interface {
+	// CheckToken returns ErrTokenRevoked if the token is no longer active
+	CheckToken(ctx context.Context, tokenID uuid.UUID) error
+	Revoke(ctx context.Context, tokenID uuid.UUID) error
+	RevokeSession(ctx context.Context, sessionID uuid.UUID) error
+	RevokeAllForUser(ctx context.Context, userID uuid.UUID) error
+}
+
+type tokenCacheEntry struct {
+	active  bool
+	expires time.Time
+}
+
+type tokenRevocationService struct {
+	tokenRepo  repositories.TokenRepository
+	terminator SessionTerminator
+
+	mu    sync.RWMutex
+	cache map[uuid.UUID]tokenCacheEntry
+}
+
+func NewTokenRevocationService(tokenRepo repositories.TokenRepository, terminator SessionTerminator) TokenRevocationService {
+	return &tokenRevocationService{
+		tokenRepo:  tokenRepo,
+		terminator: terminator,
+		cache:      make(map[uuid.UUID]tokenCacheEntry),
+	}
+}
+
+func (s *tokenRevocationService) CheckToken(ctx context.Context, tokenID uuid.UUID) error {
+	s.mu.RLock()
+	entry, ok := s.cache[tokenID]
+	s.mu.RUnlock()
+
+	if !ok || time.Now().After(entry.expires) {
+		_, err := s.tokenRepo.FindByJTI(ctx, tokenID)
+		if err != nil && !errors.Is(err, repositories.ErrTokenNotFound) {
+			return err
+		}
+		entry = s.remember(tokenID, err == nil)
+	}
+
+	if !entry.active {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+func (s *tokenRevocationService) Revoke(ctx context.Context, tokenID uuid.UUID) error {
+	if err := s.tokenRepo.DeleteByJTI(ctx, tokenID); err != nil {
+		return err
+	}
+
+	s.remember(tokenID, false)
+	s.terminator.TerminateTokenSessions(tokenID)
+	return nil
+}
+
+// RevokeSession revokes every access token issued to a session and closes its connections,
+// including ones opened with tokens that have since expired
+func (s *tokenRevocationService) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	tokens, err := s.tokenRepo.FindBySessionID(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.tokenRepo.DeleteBySessionID(ctx, sessionID); err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		s.remember(token.JTI, false)
+	}
+	s.terminator.TerminateSession(sessionID)
+	return nil
+}
+
+func (s *tokenRevocationService) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	tokens, err := s.tokenRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.tokenRepo.DeleteByUserID(ctx, userID); err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		s.remember(token.JTI, false)
+	}
+	s.terminator.TerminateUserSessions(userID)
+	return nil
+}
+
+func (s *tokenRevocationService) remember(tokenID uuid.UUID, active bool) tokenCacheEntry {
+	ttl := revokedTokenCacheTTL
+	if active {
+		ttl = activeTokenCacheTTL
+	}
+	entry := tokenCacheEntry{active: active, expires: time.Now().Add(ttl)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.cache) >= maxTokenCacheEntries {
+		s.pruneCache()
+	}
+	s.cache[tokenID] = entry
+	return entry
+}
+
+// pruneCache drops expired entries, and everything if the cache is still full.
+// It must be called with s.mu held.
+func (s *tokenRevocationService) pruneCache() {
+	now := time.Now()
+	for tokenID, entry := range s.cache {
+		if now.After(entry.expires) {
+			delete(s.cache, tokenID)
+		}
+	}
+	if len(s.cache) >= maxTokenCacheEntries {
+		s.cache = make(map[uuid.UUID]tokenCacheEntry)
+	}
+}
@@ -0,0 +1,378 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"github.com/kevinsofyan/echoes-chat-api/internal/repositories"
+	"github.com/kevinsofyan/echoes-chat-api/internal/secretbox"
+	"github.com/kevinsofyan/echoes-chat-api/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrTwoFactorNotSetUp       = errors.New("two-factor authentication has not been set up")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrInvalidChallenge        = errors.New("invalid or expired two-factor challenge")
+)
+
+const (
+	challengeTTL         = 5 * time.Minute
+	maxChallengeAttempts = 5
+	recoveryCodeCount    = 10
+)
+
+type TwoFactorService interface {
+	// Setup generates a new secret. It only takes effect once confirmed with Enable.
+	Setup(ctx context.Context, userID uuid.UUID) (*TwoFactorSetup, error)
+	// Enable confirms the secret with a code and returns the recovery codes, which are only shown once
+	Enable(ctx context.Context, userID uuid.UUID, req TwoFactorCodeRequest) ([]string, error)
+	Disable(ctx context.Context, userID uuid.UUID, req DisableTwoFactorRequest) error
+	RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, req TwoFactorCodeRequest) ([]string, error)
+
+	// CreateChallenge is called by login once the password has been checked
+	CreateChallenge(ctx context.Context, userID uuid.UUID) (*TwoFactorChallenge, error)
+	// ChallengeUser returns the user a challenge that is still open was issued
+	// to, without checking a code, so the login can be throttled first
+	ChallengeUser(ctx context.Context, challengeToken string) (uuid.UUID, error)
+	// VerifyChallenge consumes a challenge and returns the user it was issued to.
+	// The user is also returned with ErrInvalidTwoFactorCode, so the failure can be recorded.
+	VerifyChallenge(ctx context.Context, req VerifyTwoFactorRequest) (uuid.UUID, error)
+}
+
+type TwoFactorSetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TwoFactorChallenge struct {
+	Token     string `json:"challenge_token"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+// TwoFactorCodeRequest accepts either a TOTP code or an unused recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type VerifyTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+type twoFactorService struct {
+	userRepo      repositories.UserRepository
+	recoveryRepo  repositories.RecoveryCodeRepository
+	challengeRepo repositories.TwoFactorChallengeRepository
+	box           *secretbox.Box
+}
+
+func NewTwoFactorService(
+	userRepo repositories.UserRepository,
+	recoveryRepo repositories.RecoveryCodeRepository,
+	challengeRepo repositories.TwoFactorChallengeRepository,
+	box *secretbox.Box,
+) TwoFactorService {
+	return &twoFactorService{
+		userRepo:      userRepo,
+		recoveryRepo:  recoveryRepo,
+		challengeRepo: challengeRepo,
+		box:           box,
+	}
+}
+
+func (s *twoFactorService) Setup(ctx context.Context, userID uuid.UUID) (*TwoFactorSetup, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, errors.New("failed to generate secret")
+	}
+
+	sealed, err := s.box.Seal(secret, userID[:])
+	if err != nil {
+		return nil, errors.New("failed to encrypt secret")
+	}
+
+	if err := s.userRepo.SetTwoFactorSecret(ctx, userID, sealed); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorSetup{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(totpIssuer(), user.Email, secret),
+	}, nil
+}
+
+func (s *twoFactorService) Enable(ctx context.Context, userID uuid.UUID, req TwoFactorCodeRequest) ([]string, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TwoFactorSecret == "" {
+		return nil, ErrTwoFactorNotSetUp
+	}
+
+	// Only a TOTP code proves the authenticator was set up; there are no recovery codes yet
+	if err := s.checkTOTP(ctx, user, req.Code); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.userRepo.EnableTwoFactor(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *twoFactorService) Disable(ctx context.Context, userID uuid.UUID, req DisableTwoFactorRequest) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.TwoFactorEnabledAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		return ErrIncorrectPassword
+	}
+
+	if err := s.checkCode(ctx, user, req.Code); err != nil {
+		return err
+	}
+
+	if err := s.recoveryRepo.DeleteByUserID(ctx, userID); err != nil {
+		return err
+	}
+
+	return s.userRepo.DisableTwoFactor(ctx, userID)
+}
+
+func (s *twoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, req TwoFactorCodeRequest) ([]string, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabledAt == nil {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	if err := s.checkTOTP(ctx, user, req.Code); err != nil {
+		return nil, err
+	}
+
+	return s.replaceRecoveryCodes(ctx, userID)
+}
+
+func (s *twoFactorService) CreateChallenge(ctx context.Context, userID uuid.UUID) (*TwoFactorChallenge, error) {
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, errors.New("failed to generate token")
+	}
+
+	challenge := &models.TwoFactorChallenge{
+		UserID:    userID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(challengeTTL),
+	}
+
+	if err := s.challengeRepo.Create(ctx, challenge); err != nil {
+		return nil, errors.New("failed to store challenge")
+	}
+
+	return &TwoFactorChallenge{
+		Token:     token,
+		ExpiresIn: int64(challengeTTL.Seconds()),
+	}, nil
+}
+
+func (s *twoFactorService) ChallengeUser(ctx context.Context, challengeToken string) (uuid.UUID, error) {
+	challenge, err := s.challengeRepo.FindValidByHash(ctx, utils.HashToken(challengeToken))
+	if err != nil {
+		if errors.Is(err, repositories.ErrChallengeNotFound) {
+			return uuid.Nil, ErrInvalidChallenge
+		}
+		return uuid.Nil, err
+	}
+
+	if challenge.Attempts >= maxChallengeAttempts {
+		return uuid.Nil, ErrInvalidChallenge
+	}
+	return challenge.UserID, nil
+}
+
+func (s *twoFactorService) VerifyChallenge(ctx context.Context, req VerifyTwoFactorRequest) (uuid.UUID, error) {
+	challenge, err := s.challengeRepo.FindValidByHash(ctx, utils.HashToken(req.ChallengeToken))
+	if err != nil {
+		if errors.Is(err, repositories.ErrChallengeNotFound) {
+			return uuid.Nil, ErrInvalidChallenge
+		}
+		return uuid.Nil, err
+	}
+
+	// Too many wrong codes means logging in with the password again
+	if challenge.Attempts >= maxChallengeAttempts {
+		return uuid.Nil, ErrInvalidChallenge
+	}
+
+	user, err := s.userRepo.FindByID(ctx, challenge.UserID)
+	if err != nil {
+		return uuid.Nil, ErrInvalidChallenge
+	}
+
+	if err := s.checkCode(ctx, user, req.Code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			if err := s.challengeRepo.IncrementAttempts(ctx, challenge.ID); err != nil {
+				return uuid.Nil, err
+			}
+		}
+		return user.ID, err
+	}
+
+	consumed, err := s.challengeRepo.MarkUsed(ctx, challenge.ID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !consumed {
+		return uuid.Nil, ErrInvalidChallenge
+	}
+
+	return user.ID, nil
+}
+
+// checkCode accepts a TOTP code or, failing that, an unused recovery code
+func (s *twoFactorService) checkCode(ctx context.Context, user *models.User, code string) error {
+	err := s.checkTOTP(ctx, user, code)
+	if !errors.Is(err, ErrInvalidTwoFactorCode) {
+		return err
+	}
+
+	consumed, err := s.recoveryRepo.Consume(ctx, user.ID, utils.HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (s *twoFactorService) checkTOTP(ctx context.Context, user *models.User, code string) error {
+	if user.TwoFactorSecret == "" {
+		return ErrTwoFactorNotSetUp
+	}
+
+	secret, err := s.openSecret(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	step, ok := utils.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	claimed, err := s.userRepo.ClaimTwoFactorStep(ctx, user.ID, step)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// openSecret decrypts the user's TOTP secret. Secrets stored before they were
+// encrypted are sealed on first use.
+func (s *twoFactorService) openSecret(ctx context.Context, user *models.User) (string, error) {
+	if secretbox.IsSealed(user.TwoFactorSecret) {
+		return s.box.Open(user.TwoFactorSecret, user.ID[:])
+	}
+
+	sealed, err := s.box.Seal(user.TwoFactorSecret, user.ID[:])
+	if err != nil {
+		return "", err
+	}
+	if err := s.userRepo.ReplaceTwoFactorSecret(ctx, user.ID, user.TwoFactorSecret, sealed); err != nil {
+		return "", err
+	}
+	return user.TwoFactorSecret, nil
+}
+
+func (s *twoFactorService) replaceRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	records := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, errors.New("failed to generate recovery codes")
+		}
+		codes[i] = code
+		records[i] = models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashToken(normalizeRecoveryCode(code)),
+		}
+	}
+
+	if err := s.recoveryRepo.Replace(ctx, userID, records); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns 80 random bits as four groups of base32, e.g. ABCD-EFGH-IJKL-MNOP
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	raw := base32.StdEncoding.EncodeToString(b)
+	return raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16], nil
+}
+
+// normalizeRecoveryCode lets users type codes without dashes or in lower case
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "Echoes Chat"
+}
@@ -0,0 +1,495 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"github.com/kevinsofyan/echoes-chat-api/internal/repositories"
+	"github.com/kevinsofyan/echoes-chat-api/internal/storage"
+)
+
+type UploadService interface {
+	// Upload stores a file sent in a single request
+	Upload(ctx context.Context, uploaderID uuid.UUID, filename string, body io.Reader, size int64) (*models.Attachment, error)
+	// StartUpload begins a resumable upload of a file sent in chunks
+	StartUpload(ctx context.Context, uploaderID uuid.UUID, req StartUploadRequest) (*models.UploadSession, error)
+	GetUpload(ctx context.Context, uploaderID, sessionID uuid.UUID) (*models.UploadSession, error)
+	// AppendChunk writes the bytes at offset, which must equal the session's
+	// current offset. The last chunk creates the attachment.
+	AppendChunk(ctx context.Context, uploaderID, sessionID uuid.UUID, offset int64, chunk io.Reader) (*models.UploadSession, error)
+	Limits() UploadLimits
+	// RunCleanup periodically removes expired upload sessions with their staged
+	// files, and attachments that were never sent with a message. It never returns.
+	RunCleanup()
+}
+
+type StartUploadRequest struct {
+	Filename string `json:"filename" validate:"required"`
+	Size     int64  `json:"size" validate:"required"`
+}
+
+// UploadLimits caps file size in bytes by kind, as decided by the sniffed content type
+type UploadLimits struct {
+	Image int64
+	Video int64
+	Audio int64
+	File  int64
+}
+
+var (
+	ErrFileTooLarge         = errors.New("file is too large")
+	ErrEmptyUpload          = errors.New("file is empty")
+	ErrUploadNotFound       = errors.New("upload not found or expired")
+	ErrUploadOffsetMismatch = errors.New("upload offset does not match")
+	ErrChunkOutOfRange      = errors.New("chunk goes past the declared file size")
+	ErrTooManyUploads       = errors.New("too many uploads in progress")
+	ErrUploadQuotaExceeded  = errors.New("too many unsent uploads; send or wait for them to expire first")
+)
+
+const (
+	uploadSessionTTL = 24 * time.Hour
+	// maxUploadsInProgress caps a user's unfinished chunked uploads, each of
+	// which can hold up to the largest file size on disk
+	maxUploadsInProgress = 5
+	// A user's unsent attachments and unfinished uploads together are capped
+	// by count and size, so storage can't be filled before cleanup runs
+	maxUnsentUploads     = 50
+	maxUnsentUploadBytes = 1 << 30
+	// Attachments not sent with a message within unsentAttachmentTTL are deleted
+	unsentAttachmentTTL    = 24 * time.Hour
+	uploadCleanupInterval  = time.Hour
+	uploadCleanupBatchSize = 100
+	// sniffLength is how much of a file http.DetectContentType looks at
+	sniffLength = 512
+)
+
+// UploadLimitsFromEnv reads UPLOAD_MAX_IMAGE_MB, UPLOAD_MAX_VIDEO_MB,
+// UPLOAD_MAX_AUDIO_MB and UPLOAD_MAX_FILE_MB, defaulting to 10, 100, 25 and 25
+func UploadLimitsFromEnv() UploadLimits {
+	return UploadLimits{
+		Image: megabytesFromEnv("UPLOAD_MAX_IMAGE_MB", 10),
+		Video: megabytesFromEnv("UPLOAD_MAX_VIDEO_MB", 100),
+		Audio: megabytesFromEnv("UPLOAD_MAX_AUDIO_MB", 25),
+		File:  megabytesFromEnv("UPLOAD_MAX_FILE_MB", 25),
+	}
+}
+
+// UploadStagingDirFromEnv reads UPLOAD_STAGING_DIR, where chunked uploads are
+// assembled. It defaults to a directory under the system temp directory.
+func UploadStagingDirFromEnv() string {
+	if dir := os.Getenv("UPLOAD_STAGING_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "echoes-uploads")
+}
+
+func megabytesFromEnv(key string, fallback int64) int64 {
+	if mb, err := strconv.ParseInt(os.Getenv(key), 10, 64); err == nil && mb > 0 {
+		return mb << 20
+	}
+	return fallback << 20
+}
+
+func (l UploadLimits) For(kind models.MessageType) int64 {
+	switch kind {
+	case models.MessageTypeImage:
+		return l.Image
+	case models.MessageTypeVideo:
+		return l.Video
+	case models.MessageTypeAudio:
+		return l.Audio
+	default:
+		return l.File
+	}
+}
+
+// Max is the largest upload of any kind
+func (l UploadLimits) Max() int64 {
+	return max(l.Image, l.Video, l.Audio, l.File)
+}
+
+type uploadService struct {
+	attachmentRepo repositories.AttachmentRepository
+	sessionRepo    repositories.UploadSessionRepository
+	store          storage.Storage
+	processor      MediaProcessor
+	limits         UploadLimits
+	// stagingDir holds chunked uploads until they are complete
+	stagingDir string
+
+	// chunkLocks serializes writes to each upload session
+	chunkLocks sync.Map
+}
+
+func NewUploadService(
+	attachmentRepo repositories.AttachmentRepository,
+	sessionRepo repositories.UploadSessionRepository,
+	store storage.Storage,
+	processor MediaProcessor,
+	limits UploadLimits,
+	stagingDir string,
+) UploadService {
+	return &uploadService{
+		attachmentRepo: attachmentRepo,
+		sessionRepo:    sessionRepo,
+		store:          store,
+		processor:      processor,
+		limits:         limits,
+		stagingDir:     stagingDir,
+	}
+}
+
+func (s *uploadService) Limits() UploadLimits {
+	return s.limits
+}
+
+func (s *uploadService) Upload(ctx context.Context, uploaderID uuid.UUID, filename string, body io.Reader, size int64) (*models.Attachment, error) {
+	if size <= 0 {
+		return nil, ErrEmptyUpload
+	}
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(body, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	head = head[:n]
+
+	contentType := http.DetectContentType(head)
+	if size > s.limits.For(models.MessageTypeForContentType(contentType)) {
+		return nil, ErrFileTooLarge
+	}
+
+	if _, err := s.checkQuota(ctx, uploaderID, size); err != nil {
+		return nil, err
+	}
+
+	return s.saveAttachment(ctx, uploaderID, filename, contentType, io.MultiReader(bytes.NewReader(head), body), size)
+}
+
+func (s *uploadService) StartUpload(ctx context.Context, uploaderID uuid.UUID, req StartUploadRequest) (*models.UploadSession, error) {
+	if req.Size <= 0 {
+		return nil, ErrEmptyUpload
+	}
+	// The kind isn't known until the first chunk arrives, so only the overall cap applies here
+	if req.Size > s.limits.Max() {
+		return nil, ErrFileTooLarge
+	}
+
+	inProgress, err := s.checkQuota(ctx, uploaderID, req.Size)
+	if err != nil {
+		return nil, err
+	}
+	if inProgress.Count >= maxUploadsInProgress {
+		return nil, ErrTooManyUploads
+	}
+
+	session := &models.UploadSession{
+		UploaderID: uploaderID,
+		Filename:   sanitizeUploadFilename(req.Filename),
+		Size:       req.Size,
+		ExpiresAt:  time.Now().Add(uploadSessionTTL),
+	}
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(s.stagingDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+
+	return session, nil
+}
+
+func (s *uploadService) GetUpload(ctx context.Context, uploaderID, sessionID uuid.UUID) (*models.UploadSession, error) {
+	session, err := s.sessionRepo.FindActiveByID(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrUploadSessionNotFound) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+
+	// Another user's upload is reported as missing
+	if session.UploaderID != uploaderID {
+		return nil, ErrUploadNotFound
+	}
+	return session, nil
+}
+
+func (s *uploadService) AppendChunk(ctx context.Context, uploaderID, sessionID uuid.UUID, offset int64, chunk io.Reader) (*models.UploadSession, error) {
+	lock, _ := s.chunkLocks.LoadOrStore(sessionID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	session, err := s.GetUpload(ctx, uploaderID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.CompletedAt != nil || offset != session.Offset {
+		return nil, ErrUploadOffsetMismatch
+	}
+
+	path := s.stagingPath(session.ID)
+	if session.Offset == session.Size {
+		// Every byte arrived before, but storing the file failed; retry that
+		return s.completeUpload(ctx, session, path)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	// Read one byte past the remaining size to notice oversized chunks
+	remaining := session.Size - offset
+	written, err := io.Copy(file, io.LimitReader(chunk, remaining+1))
+	if err == nil && written > remaining {
+		err = ErrChunkOutOfRange
+	}
+	if err == nil && written == 0 {
+		err = ErrEmptyUpload
+	}
+	if err != nil {
+		// Drop the partial chunk so the client can resend it from the same offset
+		file.Truncate(offset)
+		return nil, err
+	}
+
+	if offset == 0 {
+		if err := s.sniffStaged(ctx, session, path); err != nil {
+			file.Truncate(0)
+			return nil, err
+		}
+	}
+
+	advanced, err := s.sessionRepo.Advance(ctx, session.ID, offset, offset+written)
+	if err != nil {
+		return nil, err
+	}
+	if !advanced {
+		return nil, ErrUploadOffsetMismatch
+	}
+	session.Offset = offset + written
+
+	if session.Offset < session.Size {
+		return session, nil
+	}
+
+	file.Close()
+	return s.completeUpload(ctx, session, path)
+}
+
+// checkQuota rejects a new upload of size bytes if it would take the uploader
+// over the unsent upload caps. Unfinished uploads count at their declared
+// size, since they become attachments once complete. Their usage is returned.
+func (s *uploadService) checkQuota(ctx context.Context, uploaderID uuid.UUID, size int64) (repositories.UploadUsage, error) {
+	unsent, err := s.attachmentRepo.UnsentUsage(ctx, uploaderID)
+	if err != nil {
+		return repositories.UploadUsage{}, err
+	}
+	inProgress, err := s.sessionRepo.InProgressUsage(ctx, uploaderID)
+	if err != nil {
+		return repositories.UploadUsage{}, err
+	}
+
+	if unsent.Count+inProgress.Count >= maxUnsentUploads || unsent.Bytes+inProgress.Bytes+size > maxUnsentUploadBytes {
+		return inProgress, ErrUploadQuotaExceeded
+	}
+	return inProgress, nil
+}
+
+// sniffStaged decides the content type from the first chunk and applies its size limit
+func (s *uploadService) sniffStaged(ctx context.Context, session *models.UploadSession, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+
+	contentType := http.DetectContentType(head[:n])
+	if session.Size > s.limits.For(models.MessageTypeForContentType(contentType)) {
+		return ErrFileTooLarge
+	}
+
+	session.ContentType = contentType
+	return s.sessionRepo.SetContentType(ctx, session.ID, contentType)
+}
+
+// completeUpload moves a fully received upload from staging into storage
+func (s *uploadService) completeUpload(ctx context.Context, session *models.UploadSession, path string) (*models.UploadSession, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	attachment, err := s.saveAttachment(ctx, session.UploaderID, session.Filename, session.ContentType, file, session.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sessionRepo.Complete(ctx, session.ID, attachment.ID); err != nil {
+		return nil, err
+	}
+
+	// The staged copy is kept until here so a failed attempt can be retried
+	os.Remove(path)
+	s.chunkLocks.Delete(session.ID)
+
+	now := time.Now()
+	session.AttachmentID = &attachment.ID
+	session.CompletedAt = &now
+	return session, nil
+}
+
+// saveAttachment writes the file to storage, records the attachment and
+// queues it for processing
+func (s *uploadService) saveAttachment(ctx context.Context, uploaderID uuid.UUID, filename, contentType string, body io.Reader, size int64) (*models.Attachment, error) {
+	attachment := &models.Attachment{
+		UploaderID:  uploaderID,
+		Filename:    sanitizeUploadFilename(filename),
+		ContentType: contentType,
+		Size:        size,
+		Status:      models.AttachmentStatusProcessing,
+	}
+	attachment.ID = uuid.New()
+	attachment.StorageKey = "attachments/" + attachment.ID.String()
+
+	if err := s.store.Put(ctx, attachment.StorageKey, body, size, contentType); err != nil {
+		return nil, fmt.Errorf("failed to store upload: %w", err)
+	}
+
+	if err := s.attachmentRepo.Create(ctx, attachment); err != nil {
+		if deleteErr := s.store.Delete(ctx, attachment.StorageKey); deleteErr != nil {
+			log.Printf("error removing orphaned upload %s: %v", attachment.StorageKey, deleteErr)
+		}
+		return nil, err
+	}
+
+	s.processor.Enqueue(attachment.ID)
+	return attachment, nil
+}
+
+func (s *uploadService) RunCleanup() {
+	ticker := time.NewTicker(uploadCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), uploadCleanupInterval)
+		s.removeExpiredSessions(ctx)
+		s.removeUnsentAttachments(ctx)
+		cancel()
+
+		<-ticker.C
+	}
+}
+
+func (s *uploadService) removeExpiredSessions(ctx context.Context) {
+	for {
+		sessions, err := s.sessionRepo.FindExpired(ctx, uploadCleanupBatchSize)
+		if err != nil {
+			log.Printf("error loading expired upload sessions: %v", err)
+			return
+		}
+
+		for _, session := range sessions {
+			// The file goes first, so a failure leaves the session to find it again
+			path := s.stagingPath(session.ID)
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("error removing staged upload %s: %v", path, err)
+				return
+			}
+			if err := s.sessionRepo.Delete(ctx, session.ID); err != nil {
+				log.Printf("error removing upload session %s: %v", session.ID, err)
+				return
+			}
+			s.chunkLocks.Delete(session.ID)
+		}
+
+		if len(sessions) < uploadCleanupBatchSize {
+			return
+		}
+	}
+}
+
+func (s *uploadService) removeUnsentAttachments(ctx context.Context) {
+	for {
+		attachments, err := s.attachmentRepo.FindUnsent(ctx, time.Now().Add(-unsentAttachmentTTL), uploadCleanupBatchSize)
+		if err != nil {
+			log.Printf("error loading unsent attachments: %v", err)
+			return
+		}
+
+		for _, attachment := range attachments {
+			deleted, err := s.attachmentRepo.DeleteUnsent(ctx, attachment.ID)
+			if err != nil {
+				log.Printf("error removing unsent attachment %s: %v", attachment.ID, err)
+				return
+			}
+			// It was sent after all
+			if !deleted {
+				continue
+			}
+
+			for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey} {
+				if key == "" {
+					continue
+				}
+				if err := s.store.Delete(ctx, key); err != nil {
+					log.Printf("error removing %s: %v", key, err)
+				}
+			}
+		}
+
+		if len(attachments) < uploadCleanupBatchSize {
+			return
+		}
+	}
+}
+
+func (s *uploadService) stagingPath(sessionID uuid.UUID) string {
+	return filepath.Join(s.stagingDir, sessionID.String())
+}
+
+// sanitizeUploadFilename keeps the base name of a client-supplied filename,
+// without control characters, for display and Content-Disposition
+func sanitizeUploadFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	name = truncate(strings.TrimSpace(name), 255)
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	return name
+}
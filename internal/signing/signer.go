@@ -0,0 +1,174 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signer signs access tokens and resolves the key to verify them with.
+// Tokens carry the signing key's ID in their kid header, so keys can be rotated:
+// a new key takes over signing while retired keys still verify tokens they issued.
+type Signer interface {
+	Sign(claims jwt.Claims) (string, error)
+	// Keyfunc is used by the JWT middleware to pick the verification key
+	Keyfunc(token *jwt.Token) (interface{}, error)
+	// JWKS lists the public keys, for services verifying tokens without a shared secret
+	JWKS() JWKS
+}
+
+// Key is a signing key. Symmetric keys are never published.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewHMACKey creates an HS256 key from a shared secret
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, Method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+}
+
+// NewKeyFromPEM parses a PKCS#8 or PKCS#1 private key. RSA keys sign with RS256 and Ed25519 keys with EdDSA.
+func NewKeyFromPEM(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM block found", id)
+	}
+
+	var private interface{}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		rsaKey, rsaErr := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if rsaErr != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		private = rsaKey
+	}
+
+	switch key := private.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("key %s: RSA keys must be at least 2048 bits", id)
+		}
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, signKey: key, verifyKey: &key.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, signKey: key, verifyKey: key.Public()}, nil
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %T", id, private)
+	}
+}
+
+type keySet struct {
+	active *Key
+	keys   map[string]*Key
+	// order keeps the JWKS output stable
+	order []string
+}
+
+// NewKeySet signs with active and verifies with active and every other key,
+// whether retired or waiting to take over signing
+func NewKeySet(active *Key, others ...*Key) (Signer, error) {
+	set := &keySet{active: active, keys: make(map[string]*Key)}
+	for _, key := range append([]*Key{active}, others...) {
+		if _, ok := set.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key ID %q", key.ID)
+		}
+		set.keys[key.ID] = key
+		set.order = append(set.order, key.ID)
+	}
+	return set, nil
+}
+
+// NewFromEnv loads keys from JWT_SIGNING_KEYS, a comma-separated list of
+// kid:path-to-pem pairs. The first key signs; the rest are retired keys kept
+// for verification until the tokens they signed expire. Without it, tokens
+// are signed with HS256 using JWT_SECRET.
+//
+// JWT_NEXT_SIGNING_KEYS lists keys in the same format that are published in
+// the JWKS but don't sign yet. Verifiers cache the JWKS for up to five
+// minutes, so a key should be listed there for at least that long before it
+// moves to the front of JWT_SIGNING_KEYS; otherwise tokens it signs are
+// rejected until their caches expire.
+func NewFromEnv() (Signer, error) {
+	next, err := keysFromEnv("JWT_NEXT_SIGNING_KEYS")
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := keysFromEnv("JWT_SIGNING_KEYS")
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		if len(next) > 0 {
+			return nil, errors.New("JWT_NEXT_SIGNING_KEYS requires JWT_SIGNING_KEYS")
+		}
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			return nil, errors.New("JWT_SIGNING_KEYS or JWT_SECRET must be set")
+		}
+		return NewKeySet(NewHMACKey("default", []byte(secret)))
+	}
+
+	return NewKeySet(keys[0], append(keys[1:], next...)...)
+}
+
+// keysFromEnv loads the kid:path-to-pem pairs listed in the env var name
+func keysFromEnv(name string) ([]*Key, error) {
+	spec := strings.TrimSpace(os.Getenv(name))
+	if spec == "" {
+		return nil, nil
+	}
+
+	var keys []*Key
+	for _, entry := range strings.Split(spec, ",") {
+		id, path, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" || path == "" {
+			return nil, fmt.Errorf("invalid %s entry %q, expected kid:path", name, entry)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+
+		key, err := NewKeyFromPEM(id, data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *keySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.active.Method, claims)
+	token.Header["kid"] = s.active.ID
+	return token.SignedString(s.active.signKey)
+}
+
+func (s *keySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	key := s.active
+	// Tokens issued before keys had IDs are checked against the active key
+	if kid, ok := token.Header["kid"].(string); ok {
+		key, ok = s.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+
+	// The algorithm is fixed per key, so a token can't choose a weaker one
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
@@ -0,0 +1,227 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newEd25519Key(t *testing.T, id string) (*Key, []byte) {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	key, err := NewKeyFromPEM(id, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, data
+}
+
+func testClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}
+}
+
+func parse(signer Signer, token string) error {
+	_, err := jwt.ParseWithClaims(token, &jwt.RegisteredClaims{}, signer.Keyfunc)
+	return err
+}
+
+func TestKeySetRotation(t *testing.T) {
+	old, _ := newEd25519Key(t, "old")
+	current, _ := newEd25519Key(t, "current")
+
+	before, err := NewKeySet(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := before.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := NewKeySet(current, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := after.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The retired key still verifies what it signed, while the new key signs
+	if err := parse(after, oldToken); err != nil {
+		t.Errorf("token from the retired key was rejected: %v", err)
+	}
+	if err := parse(after, newToken); err != nil {
+		t.Errorf("token from the active key was rejected: %v", err)
+	}
+	if err := parse(before, newToken); err == nil {
+		t.Error("token signed with a key the set doesn't know was accepted")
+	}
+
+	token, _, err := jwt.NewParser().ParseUnverified(newToken, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["kid"] != "current" {
+		t.Errorf("got kid %v, want current", token.Header["kid"])
+	}
+}
+
+func TestKeySetRejectsAlgorithmSwitch(t *testing.T) {
+	secret := []byte("shared secret")
+	set, err := NewKeySet(NewHMACKey("default", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same key material and kid, but a different algorithm
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, testClaims())
+	token.Header["kid"] = "default"
+	signed, err := token.SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parse(set, signed); err == nil {
+		t.Error("token with a different algorithm was accepted")
+	}
+}
+
+func TestKeySetRejectsDuplicateIDs(t *testing.T) {
+	a, _ := newEd25519Key(t, "same")
+	b, _ := newEd25519Key(t, "same")
+	if _, err := NewKeySet(a, b); err == nil {
+		t.Error("duplicate key IDs were accepted")
+	}
+}
+
+func TestJWKSPublishesOnlyPublicKeys(t *testing.T) {
+	edKey, _ := newEd25519Key(t, "ed")
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := NewKeyFromPEM("rsa", pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(rsaPrivate),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := NewKeySet(edKey, rsaKey, NewHMACKey("hmac", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := set.JWKS()
+
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("got %d keys, want the Ed25519 and RSA keys only", len(jwks.Keys))
+	}
+	if _, ok := jwks.Find("hmac"); ok {
+		t.Fatal("shared secret was published")
+	}
+
+	// Tokens verify against the published keys alone
+	signed, err := set.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	published, ok := jwks.Find("ed")
+	if !ok {
+		t.Fatal("active key missing from the JWKS")
+	}
+	_, err = jwt.ParseWithClaims(signed, &jwt.RegisteredClaims{}, func(*jwt.Token) (interface{}, error) {
+		return published.PublicKey()
+	})
+	if err != nil {
+		t.Errorf("token didn't verify against the JWKS: %v", err)
+	}
+
+	rsaPublished, _ := jwks.Find("rsa")
+	public, err := rsaPublished.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rsaPrivate.PublicKey.Equal(public) {
+		t.Error("published RSA key doesn't match")
+	}
+}
+
+func TestNewKeyFromPEMRejectsWeakRSA(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+	if _, err := NewKeyFromPEM("weak", data); err == nil {
+		t.Error("1024-bit RSA key was accepted")
+	}
+}
+
+func TestNewFromEnvPublishesNextKeysWithoutSigning(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	_, currentPEM := newEd25519Key(t, "current")
+	_, nextPEM := newEd25519Key(t, "next")
+
+	t.Setenv("JWT_SIGNING_KEYS", "current:"+write("current.pem", currentPEM))
+	t.Setenv("JWT_NEXT_SIGNING_KEYS", "next:"+write("next.pem", nextPEM))
+
+	signer, err := NewFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := signer.JWKS().Find("next"); !ok {
+		t.Error("next key isn't published")
+	}
+
+	signed, err := signer.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(signed, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["kid"] != "current" {
+		t.Errorf("signed with %v, want current", token.Header["kid"])
+	}
+}
+
+func TestNewFromEnvRequiresAKey(t *testing.T) {
+	t.Setenv("JWT_SIGNING_KEYS", "")
+	t.Setenv("JWT_NEXT_SIGNING_KEYS", "")
+	t.Setenv("JWT_SECRET", "")
+	if _, err := NewFromEnv(); err == nil {
+		t.Error("no key configured was accepted")
+	}
+
+	t.Setenv("JWT_SIGNING_KEYS", "missing-path")
+	if _, err := NewFromEnv(); err == nil {
+		t.Error("entry without a path was accepted")
+	}
+}
@@ -0,0 +1,37 @@
+package signing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestURLSigner(t *testing.T) {
+	signer := NewURLSigner([]byte("secret"))
+	expires := time.Unix(1700000000, 0)
+	signature := signer.Sign("attachments/1", expires)
+
+	if !signer.Verify("attachments/1", expires, signature) {
+		t.Fatal("valid signature was rejected")
+	}
+
+	tests := []struct {
+		name      string
+		signer    *URLSigner
+		resource  string
+		expires   time.Time
+		signature string
+	}{
+		{"other resource", signer, "attachments/2", expires, signature},
+		{"extended expiry", signer, "attachments/1", expires.Add(time.Hour), signature},
+		{"other secret", NewURLSigner([]byte("other")), "attachments/1", expires, signature},
+		{"not hex", signer, "attachments/1", expires, "zz"},
+		{"empty", signer, "attachments/1", expires, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.signer.Verify(tt.resource, tt.expires, tt.signature) {
+				t.Error("signature was accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+type objectReader struct {
+	ctx    context.Context
+	store  Storage
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+// NewReadSeeker reads an object of known size through ranged reads, opening
+// the object lazily at the current offset. It lets http.ServeContent answer
+// range requests without downloading the whole object first.
+func NewReadSeeker(ctx context.Context, store Storage, key string, size int64) io.ReadSeekCloser {
+	return &objectReader{ctx: ctx, store: store, key: key, size: size}
+}
+
+func (r *objectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		body, err := r.store.GetRange(r.ctx, r.key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *objectReader) Seek(offset int64, whence int) (int64, error) {
+	var next int64
+	switch whence {
+	case io.SeekStart:
+		next = offset
+	case io.SeekCurrent:
+		next = r.offset + offset
+	case io.SeekEnd:
+		next = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if next < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if next != r.offset {
+		r.closeBody()
+		r.offset = next
+	}
+	return next, nil
+}
+
+func (r *objectReader) Close() error {
+	return r.closeBody()
+}
+
+func (r *objectReader) closeBody() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Storage keeps uploaded files as objects addressed by key. Keys are
+// generated by the server and use forward slashes, e.g. "attachments/<uuid>".
+type Storage interface {
+	// Put stores exactly size bytes from body under key, replacing any existing object
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get opens an object for reading. It returns ErrNotFound for unknown keys.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// GetRange reads length bytes from offset, or through the end when length is negative
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Delete removes an object; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// NewFromEnv picks a backend using STORAGE ("local" or "s3"). The local
+// backend writes under STORAGE_DIR, default "uploads". The S3 backend reads
+// S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY
+// and S3_FORCE_PATH_STYLE, which most S3-compatible servers such as MinIO need.
+func NewFromEnv() (Storage, error) {
+	switch backend := os.Getenv("STORAGE"); backend {
+	case "", "local":
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		return NewLocal(dir)
+	case "s3":
+		pathStyle, _ := strconv.ParseBool(os.Getenv("S3_FORCE_PATH_STYLE"))
+		return NewS3(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       pathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown STORAGE backend %q", backend)
+	}
+}
@@ -2,37 +2,102 @@ package utils
 
 import (
 	"errors"
+	"strings"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
-func GetUserIDFromContext(c echo.Context) (uuid.UUID, error) {
-	user := c.Get("user").(*jwt.Token)
-	claims := user.Claims.(jwt.MapClaims)
+// principalContextKey is where the auth middleware stores the caller
+const principalContextKey = "principal"
+
+var ErrUnauthenticated = errors.New("request is not authenticated")
+
+// Principal is the authenticated caller, taken from a verified access token
+type Principal struct {
+	UserID    uuid.UUID
+	Username  string
+	Email     string
+	SessionID uuid.UUID
+	TokenID   uuid.UUID
+	Scopes    []string
+}
 
-	userIDStr, ok := claims["user_id"].(string)
-	if !ok {
-		return uuid.Nil, errors.New("user_id not found in token")
+// PrincipalFromClaims validates the identifiers in verified claims
+func PrincipalFromClaims(claims *JWTClaims) (*Principal, error) {
+	if claims.UserID == uuid.Nil {
+		return nil, errors.New("user_id not found in token")
+	}
+	if claims.SessionID == uuid.Nil {
+		return nil, errors.New("sid not found in token")
 	}
 
-	userID, err := uuid.Parse(userIDStr)
+	tokenID, err := uuid.Parse(claims.ID)
 	if err != nil {
-		return uuid.Nil, errors.New("invalid user_id format")
+		return nil, errors.New("invalid jti format")
 	}
 
-	return userID, nil
+	return &Principal{
+		UserID:    claims.UserID,
+		Username:  claims.Username,
+		Email:     claims.Email,
+		SessionID: claims.SessionID,
+		TokenID:   tokenID,
+		Scopes:    strings.Fields(claims.Scope),
+	}, nil
 }
 
-func GetUsernameFromContext(c echo.Context) (string, error) {
-	user := c.Get("user").(*jwt.Token)
-	claims := user.Claims.(jwt.MapClaims)
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func SetPrincipal(c echo.Context, principal *Principal) {
+	c.Set(principalContextKey, principal)
+}
 
-	username, ok := claims["username"].(string)
-	if !ok {
-		return "", errors.New("username not found in token")
+// GetPrincipal returns ErrUnauthenticated, rather than panicking, on routes
+// the auth middleware isn't mounted on
+func GetPrincipal(c echo.Context) (*Principal, error) {
+	principal, ok := c.Get(principalContextKey).(*Principal)
+	if !ok || principal == nil {
+		return nil, ErrUnauthenticated
 	}
+	return principal, nil
+}
 
-	return username, nil
+func GetUserIDFromContext(c echo.Context) (uuid.UUID, error) {
+	principal, err := GetPrincipal(c)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return principal.UserID, nil
+}
+
+func GetTokenIDFromContext(c echo.Context) (uuid.UUID, error) {
+	principal, err := GetPrincipal(c)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return principal.TokenID, nil
+}
+
+func GetSessionIDFromContext(c echo.Context) (uuid.UUID, error) {
+	principal, err := GetPrincipal(c)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return principal.SessionID, nil
+}
+
+func GetUsernameFromContext(c echo.Context) (string, error) {
+	principal, err := GetPrincipal(c)
+	if err != nil {
+		return "", err
+	}
+	return principal.Username, nil
 }
@@ -1,38 +1,64 @@
 package utils
 
 import (
-	"errors"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/signing"
+)
+
+// AccessTokenTTL is kept short since refresh tokens are used to obtain new access tokens
+const AccessTokenTTL = 15 * time.Minute
+
+// AccessTokenScope is granted to every token issued at login, as a space-separated scope claim
+const AccessTokenScope = "chat:read chat:write"
+
+// AccessTokenIssuer and AccessTokenAudience are set as the iss and aud claims. Other
+// services verify tokens against the published JWKS, so they need these to tell
+// tokens meant for this API apart from ones meant for them.
+const (
+	AccessTokenIssuer   = "echoes-chat-api"
+	AccessTokenAudience = "echoes-chat-api"
 )
 
 type JWTClaims struct {
-	UserID   uuid.UUID `json:"user_id"`
-	Username string    `json:"username"`
-	Email    string    `json:"email"`
+	UserID    uuid.UUID `json:"user_id"`
+	SessionID uuid.UUID `json:"sid"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Scope     string    `json:"scope,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID uuid.UUID, username, email string) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return "", errors.New("JWT_SECRET not set")
-	}
-
+// GenerateToken signs an access token. tokenID becomes the jti claim, which is
+// what revocation checks look up, and sessionID the sid claim.
+func GenerateToken(signer signing.Signer, tokenID, sessionID, userID uuid.UUID, username, email string) (string, error) {
 	claims := JWTClaims{
-		UserID:   userID,
-		Username: username,
-		Email:    email,
+		UserID:    userID,
+		SessionID: sessionID,
+		Username:  username,
+		Email:     email,
+		Scope:     AccessTokenScope,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // 24 hours
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        tokenID.String(),
+			Issuer:    AccessTokenIssuer,
+			Audience:  jwt.ClaimStrings{AccessTokenAudience},
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return signer.Sign(claims)
+}
+
+// NewAccessTokenParser returns a parser that only accepts unexpired access tokens
+// issued by this API for this API
+func NewAccessTokenParser() *jwt.Parser {
+	return jwt.NewParser(
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(AccessTokenIssuer),
+		jwt.WithAudience(AccessTokenAudience),
+	)
 }
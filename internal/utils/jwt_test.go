@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/signing"
+)
+
+func TestAccessTokenRoundTrip(t *testing.T) {
+	signer, err := signing.NewKeySet(signing.NewHMACKey("default", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenID, sessionID, userID := uuid.New(), uuid.New(), uuid.New()
+
+	signed, err := GenerateToken(signer, tokenID, sessionID, userID, "alice", "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := &JWTClaims{}
+	if _, err := NewAccessTokenParser().ParseWithClaims(signed, claims, signer.Keyfunc); err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != userID || claims.SessionID != sessionID || claims.ID != tokenID.String() {
+		t.Errorf("got claims %+v", claims)
+	}
+}
+
+func TestAccessTokenParserRejectsOtherTokens(t *testing.T) {
+	signer, err := signing.NewKeySet(signing.NewHMACKey("default", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := func() jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			Issuer:    AccessTokenIssuer,
+			Audience:  jwt.ClaimStrings{AccessTokenAudience},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*jwt.RegisteredClaims)
+	}{
+		{"other issuer", func(c *jwt.RegisteredClaims) { c.Issuer = "other-service" }},
+		{"other audience", func(c *jwt.RegisteredClaims) { c.Audience = jwt.ClaimStrings{"other-service"} }},
+		{"no audience", func(c *jwt.RegisteredClaims) { c.Audience = nil }},
+		{"no expiry", func(c *jwt.RegisteredClaims) { c.ExpiresAt = nil }},
+		{"expired", func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.modify(&claims)
+			signed, err := signer.Sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewAccessTokenParser().ParseWithClaims(signed, &JWTClaims{}, signer.Keyfunc); err == nil {
+				t.Error("token was accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed from RFC 6238 appendix B, base32 encoded
+var rfc6238Secret = base32NoPadding.EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateTOTPMatchesRFC6238(t *testing.T) {
+	// The RFC lists 8-digit codes; authenticator apps use their last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfc6238Secret, tt.code, time.Unix(tt.unix, 0))
+		if !ok {
+			t.Errorf("code %s at %d was rejected", tt.code, tt.unix)
+			continue
+		}
+		if want := tt.unix / totpPeriod; step != want {
+			t.Errorf("code %s at %d matched step %d, want %d", tt.code, tt.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPAllowsOneStepOfDrift(t *testing.T) {
+	at := time.Unix(1234567890, 0)
+	code := "005924"
+
+	for _, drift := range []time.Duration{-totpPeriod * time.Second, totpPeriod * time.Second} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, at.Add(drift)); !ok {
+			t.Errorf("code rejected with %s of drift", drift)
+		}
+	}
+	for _, drift := range []time.Duration{-2 * totpPeriod * time.Second, 2 * totpPeriod * time.Second} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, at.Add(drift)); ok {
+			t.Errorf("code accepted with %s of drift", drift)
+		}
+	}
+}
+
+func TestValidateTOTPRejectsMalformedInput(t *testing.T) {
+	at := time.Unix(1234567890, 0)
+
+	tests := map[string]struct{ secret, code string }{
+		"wrong code":   {rfc6238Secret, "005925"},
+		"short code":   {rfc6238Secret, "05924"},
+		"long code":    {rfc6238Secret, "89005924"},
+		"empty code":   {rfc6238Secret, ""},
+		"bad secret":   {"not base32!", "005924"},
+		"other secret": {base32NoPadding.EncodeToString([]byte("another secret")), "005924"},
+	}
+	for name, tt := range tests {
+		if _, ok := ValidateTOTP(tt.secret, tt.code, at); ok {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	// Codes are often pasted with whitespace and secrets typed in lower case
+	if _, ok := ValidateTOTP(strings.ToLower(rfc6238Secret), " 005924 ", at); !ok {
+		t.Error("lower case secret with padded code was rejected")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != 20 {
+		t.Errorf("got a %d-byte secret, want 20", len(key))
+	}
+
+	other, _ := GenerateTOTPSecret()
+	if other == secret {
+		t.Error("two secrets were the same")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(TOTPProvisioningURI("Echoes Chat", "ana@example.com", rfc6238Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" {
+		t.Errorf("got %s://%s, want otpauth://totp", uri.Scheme, uri.Host)
+	}
+	if uri.Path != "/Echoes Chat:ana@example.com" {
+		t.Errorf("got label %q", uri.Path)
+	}
+
+	q := uri.Query()
+	if q.Get("secret") != rfc6238Secret || q.Get("issuer") != "Echoes Chat" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("unexpected parameters %v", q)
+	}
+}
@@ -1,13 +1,13 @@
 package websocket
 
 import (
-	"context"
 	"encoding/json"
 	"log"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
 	"github.com/kevinsofyan/echoes-chat-api/internal/services"
 )
 
@@ -15,34 +15,49 @@ const (
 	writeWait      = 10 * time.Second
 	pongWait       = 60 * time.Second
 	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 512
+	maxMessageSize = 64 << 10 // room for a message send's content and attachment IDs
 )
 
 type Client struct {
-	UserID         uuid.UUID
+	// ID identifies this connection, distinguishing a user's devices and tabs
+	ID     uuid.UUID
+	UserID uuid.UUID
+	// TokenID and SessionID identify the token the connection was opened with and its session
+	TokenID        uuid.UUID
+	SessionID      uuid.UUID
 	conn           *websocket.Conn
 	hub            *Hub
-	send           chan *Message
+	send           chan *Event
 	messageService services.MessageService
+
+	// status and lastActive are guarded by the hub's mutex
+	status     models.PresenceStatus
+	lastActive time.Time
 }
 
-func NewClient(userID uuid.UUID, conn *websocket.Conn, hub *Hub, messageService services.MessageService) *Client {
+func NewClient(userID, tokenID, sessionID uuid.UUID, conn *websocket.Conn, hub *Hub, messageService services.MessageService) *Client {
 	return &Client{
+		ID:             uuid.New(),
 		UserID:         userID,
+		TokenID:        tokenID,
+		SessionID:      sessionID,
 		conn:           conn,
 		hub:            hub,
-		send:           make(chan *Message, 256),
+		send:           make(chan *Event, 256),
 		messageService: messageService,
+		status:         models.PresenceOnline,
+		lastActive:     time.Now(),
 	}
 }
 
-// ReadPump pumps messages from the websocket connection to the hub
+// ReadPump reads envelopes from the websocket connection and dispatches them
 func (c *Client) ReadPump() {
 	defer func() {
 		c.hub.Unregister <- c
 		c.conn.Close()
 	}()
 
+	c.conn.SetReadLimit(maxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error {
 		c.conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -50,7 +65,7 @@ func (c *Client) ReadPump() {
 	})
 
 	for {
-		_, messageBytes, err := c.conn.ReadMessage()
+		_, frame, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("error: %v", err)
@@ -58,36 +73,13 @@ func (c *Client) ReadPump() {
 			break
 		}
 
-		var message Message
-		if err := json.Unmarshal(messageBytes, &message); err != nil {
-			log.Printf("error unmarshaling message: %v", err)
-			continue
-		}
-
-		// Set sender ID from authenticated user
-		message.SenderID = c.UserID
-
-		// Save message to database
-		ctx := context.Background()
-		savedMsg, err := c.messageService.CreateMessage(ctx, services.CreateMessageRequest{
-			RoomID:    message.RoomID,
-			SenderID:  c.UserID,
-			Content:   message.Content,
-			Type:      message.Type,
-			ReplyToID: message.ReplyToID,
-		})
-
-		if err != nil {
-			log.Printf("error saving message: %v", err)
+		var env Envelope
+		if err := json.Unmarshal(frame, &env); err != nil || env.Type == "" {
+			c.hub.SendToClient(c, NewErrorEvent(env.ID, ErrCodeInvalidPayload, "frame must be an envelope with a type"))
 			continue
 		}
 
-		// Update message with saved data (ID, timestamps, etc.)
-		message.ID = savedMsg.ID
-		message.CreatedAt = savedMsg.CreatedAt
-
-		// Broadcast to all clients in the room
-		c.hub.Broadcast <- &message
+		c.dispatch(&env)
 	}
 }
 
@@ -101,7 +93,7 @@ func (c *Client) WritePump() {
 
 	for {
 		select {
-		case message, ok := <-c.send:
+		case event, ok := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
@@ -113,13 +105,13 @@ func (c *Client) WritePump() {
 				return
 			}
 
-			messageBytes, err := json.Marshal(message)
+			eventBytes, err := json.Marshal(event)
 			if err != nil {
-				log.Printf("error marshaling message: %v", err)
+				log.Printf("error marshaling event: %v", err)
 				continue
 			}
 
-			w.Write(messageBytes)
+			w.Write(eventBytes)
 
 			if err := w.Close(); err != nil {
 				return
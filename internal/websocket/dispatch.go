@@ -0,0 +1,262 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"github.com/kevinsofyan/echoes-chat-api/internal/services"
+)
+
+const requestTimeout = 10 * time.Second
+
+// requestHandler processes one client request. The returned value becomes the payload of the ack.
+type requestHandler func(ctx context.Context, c *Client, env *Envelope) (interface{}, error)
+
+var requestHandlers = map[EventType]requestHandler{
+	EventMessageSend:    handleMessageSend,
+	EventMessageEdit:    handleMessageEdit,
+	EventMessageDelete:  handleMessageDelete,
+	EventTypingStart:    handleTypingStart,
+	EventTypingStop:     handleTypingStop,
+	EventReadAck:        handleReadAck,
+	EventPresenceUpdate: handlePresenceUpdate,
+	EventReactionAdd:    handleReactionAdd,
+	EventReactionRemove: handleReactionRemove,
+}
+
+// requestError is a protocol-level failure reported to the client with a specific code
+type requestError struct {
+	code    string
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func invalidPayload(format string, args ...interface{}) error {
+	return &requestError{code: ErrCodeInvalidPayload, message: fmt.Sprintf(format, args...)}
+}
+
+// dispatch routes a client frame to its handler. Errors are always reported,
+// while acks are only sent for requests that carry an ID to correlate them with.
+func (c *Client) dispatch(env *Envelope) {
+	if env.Version != 0 && env.Version != ProtocolVersion {
+		c.hub.SendToClient(c, NewErrorEvent(env.ID, ErrCodeUnsupportedVersion,
+			fmt.Sprintf("protocol version %d is not supported", env.Version)))
+		return
+	}
+
+	// Any request shows the user is active; presence.update sets the status explicitly
+	if env.Type != EventPresenceUpdate {
+		c.hub.SetClientStatus(c, models.PresenceOnline)
+	}
+
+	handle, ok := requestHandlers[env.Type]
+	if !ok {
+		c.hub.SendToClient(c, NewErrorEvent(env.ID, ErrCodeUnsupportedType,
+			fmt.Sprintf("unsupported event type %q", env.Type)))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	result, err := handle(ctx, c, env)
+	if err != nil {
+		var reqErr *requestError
+		if errors.As(err, &reqErr) {
+			c.hub.SendToClient(c, NewErrorEvent(env.ID, reqErr.code, reqErr.message))
+			return
+		}
+
+		log.Printf("error handling %s from user %s: %v", env.Type, c.UserID, err)
+		c.hub.SendToClient(c, errorEventFromService(env.ID, err))
+		return
+	}
+
+	if env.ID != "" {
+		c.hub.SendToClient(c, NewAckEvent(env.ID, result))
+	}
+}
+
+func decodePayload(env *Envelope, v interface{}) error {
+	if len(env.Payload) == 0 {
+		return invalidPayload("payload is required")
+	}
+	if err := json.Unmarshal(env.Payload, v); err != nil {
+		return invalidPayload("invalid %s payload", env.Type)
+	}
+	return nil
+}
+
+func handleMessageSend(ctx context.Context, c *Client, env *Envelope) (interface{}, error) {
+	var payload SendMessagePayload
+	if err := decodePayload(env, &payload); err != nil {
+		return nil, err
+	}
+	// A file can be sent without a caption
+	if payload.Content == "" && payload.FileURL == "" && len(payload.AttachmentIDs) == 0 {
+		return nil, invalidPayload("content is required")
+	}
+
+	// An empty type is decided by the service from the attachments
+	savedMsg, err := c.messageService.CreateMessage(ctx, services.CreateMessageRequest{
+		RoomID:        payload.RoomID,
+		SenderID:      c.UserID,
+		Content:       payload.Content,
+		Type:          payload.Type,
+		FileURL:       payload.FileURL,
+		ReplyToID:     payload.ReplyToID,
+		AttachmentIDs: payload.AttachmentIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Sending a message ends the sender's typing indicator in that room
+	c.hub.StopTyping(savedMsg.RoomID, c.UserID)
+
+	c.hub.Broadcast <- NewMessageEvent(savedMsg)
+
+	return MessageFromModel(savedMsg), nil
+}
+
+func handleMessageEdit(ctx context.Context, c *Client, env *Envelope) (interface{}, error) {
+	var payload EditMessagePayload
+	if err := decodePayload(env, &payload); err != nil {
+		return nil, err
+	}
+	if payload.Content == "" {
+		return nil, invalidPayload("content is required")
+	}
+
+	updated, err := c.messageService.UpdateMessage(ctx, payload.MessageID, c.UserID, services.UpdateMessageRequest{
+		Content: payload.Content,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.hub.Broadcast <- NewMessageUpdatedEvent(updated)
+
+	return MessageFromModel(updated), nil
+}
+
+func handleMessageDelete(ctx context.Context, c *Client, env *Envelope) (interface{}, error) {
+	var payload DeleteMessagePayload
+	if err := decodePayload(env, &payload); err != nil {
+		return nil, err
+	}
+
+	deleted, err := c.messageService.DeleteMessage(ctx, payload.MessageID, c.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.hub.Broadcast <- NewMessageDeletedEvent(deleted)
+
+	return MessageDeletedPayload{ID: deleted.ID, RoomID: deleted.RoomID}, nil
+}
+
+// Typing indicators are ephemeral: they are relayed through the hub and never persisted
+func handleTypingStart(ctx context.Context, c *Client, env *Envelope) (interface{}, error) {
+	var payload TypingPayload
+	if err := decodePayload(env, &payload); err != nil {
+		return nil, err
+	}
+
+	if err := c.hub.StartTyping(payload.RoomID, c.UserID); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func handleTypingStop(ctx context.Context, c *Client, env *Envelope) (interface{}, error) {
+	var payload TypingPayload
+	if err := decodePayload(env, &payload); err != nil {
+		return nil, err
+	}
+
+	c.hub.StopTyping(payload.RoomID, c.UserID)
+	return nil, nil
+}
+
+func handleReadAck(ctx context.Context, c *Client, env *Envelope) (interface{}, error) {
+	var payload ReadAckPayload
+	if err := decodePayload(env, &payload); err != nil {
+		return nil, err
+	}
+
+	read, err := c.messageService.MarkAsRead(ctx, payload.RoomID, c.UserID, services.MarkReadRequest{
+		MessageID: payload.MessageID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The reader's other devices receive the receipt too, so they can clear their unread state
+	event := NewReadReceiptEvent(read)
+	c.hub.Broadcast <- event
+
+	return event.Payload, nil
+}
+
+func handleReactionAdd(ctx context.Context, c *Client, env *Envelope) (interface{}, error) {
+	var payload ReactionRequestPayload
+	if err := decodePayload(env, &payload); err != nil {
+		return nil, err
+	}
+
+	change, err := c.messageService.AddReaction(ctx, payload.MessageID, c.UserID, services.ReactionRequest{
+		Emoji: payload.Emoji,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Repeating a reaction changes nothing, so there is nothing to announce
+	event := NewReactionAddedEvent(change)
+	if change.Changed {
+		c.hub.Broadcast <- event
+	}
+
+	return event.Payload, nil
+}
+
+func handleReactionRemove(ctx context.Context, c *Client, env *Envelope) (interface{}, error) {
+	var payload ReactionRequestPayload
+	if err := decodePayload(env, &payload); err != nil {
+		return nil, err
+	}
+
+	change, err := c.messageService.RemoveReaction(ctx, payload.MessageID, c.UserID, services.ReactionRequest{
+		Emoji: payload.Emoji,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	event := NewReactionRemovedEvent(change)
+	c.hub.Broadcast <- event
+
+	return event.Payload, nil
+}
+
+func handlePresenceUpdate(ctx context.Context, c *Client, env *Envelope) (interface{}, error) {
+	var payload PresencePayload
+	if err := decodePayload(env, &payload); err != nil {
+		return nil, err
+	}
+	if payload.Status != models.PresenceOnline && payload.Status != models.PresenceAway {
+		return nil, invalidPayload("status must be online or away")
+	}
+
+	c.hub.SetClientStatus(c, payload.Status)
+	return nil, nil
+}
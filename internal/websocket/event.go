@@ -0,0 +1,251 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"github.com/kevinsofyan/echoes-chat-api/internal/services"
+)
+
+// ProtocolVersion is the envelope version spoken by this server.
+// Frames that omit "v" are treated as the current version.
+const ProtocolVersion = 1
+
+type EventType string
+
+// Client -> server requests
+const (
+	EventMessageSend    EventType = "message.send"
+	EventMessageEdit    EventType = "message.edit"
+	EventMessageDelete  EventType = "message.delete"
+	EventTypingStart    EventType = "typing.start"
+	EventTypingStop     EventType = "typing.stop"
+	EventReadAck        EventType = "read.ack"
+	EventReactionAdd    EventType = "reaction.add"
+	EventReactionRemove EventType = "reaction.remove"
+)
+
+// presence.update is sent by clients as a heartbeat carrying their own status,
+// and by the server to announce the status of users who share a room
+const EventPresenceUpdate EventType = "presence.update"
+
+// Server -> client events. typing.start and typing.stop are also relayed to other members.
+const (
+	EventMessageNew      EventType = "message.new"
+	EventMessageUpdated  EventType = "message.updated"
+	EventMessageDeleted  EventType = "message.deleted"
+	EventReadReceipt     EventType = "read.receipt"
+	EventAttachmentReady EventType = "attachment.ready"
+	EventReactionAdded   EventType = "reaction.added"
+	EventReactionRemoved EventType = "reaction.removed"
+	EventAck             EventType = "ack"
+	EventError           EventType = "error"
+)
+
+const (
+	ErrCodeInvalidPayload     = "invalid_payload"
+	ErrCodeUnsupportedType    = "unsupported_type"
+	ErrCodeUnsupportedVersion = "unsupported_version"
+	ErrCodeForbidden          = "forbidden"
+	ErrCodeNotFound           = "not_found"
+	ErrCodeSessionRevoked     = "session_revoked"
+	ErrCodeInternal           = "internal_error"
+)
+
+// Envelope is a frame received from a client. ID is chosen by the client and
+// echoed back on the ack or error so it can correlate the response.
+type Envelope struct {
+	Version int             `json:"v"`
+	Type    EventType       `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Event is the frame written to clients. RoomID, Recipients and ExcludeUserID are
+// only used by the hub for routing: Recipients, when set, replaces room fan-out.
+type Event struct {
+	Version       int         `json:"v"`
+	Type          EventType   `json:"type"`
+	ID            string      `json:"id,omitempty"`
+	RoomID        uuid.UUID   `json:"-"`
+	Recipients    []uuid.UUID `json:"-"`
+	ExcludeUserID uuid.UUID   `json:"-"`
+	Payload       interface{} `json:"payload"`
+}
+
+type SendMessagePayload struct {
+	RoomID        uuid.UUID   `json:"room_id"`
+	Content       string      `json:"content"`
+	Type          string      `json:"type"`
+	FileURL       string      `json:"file_url,omitempty"`
+	ReplyToID     *uuid.UUID  `json:"reply_to_id,omitempty"`
+	AttachmentIDs []uuid.UUID `json:"attachment_ids,omitempty"`
+}
+
+type EditMessagePayload struct {
+	MessageID uuid.UUID `json:"message_id"`
+	Content   string    `json:"content"`
+}
+
+type DeleteMessagePayload struct {
+	MessageID uuid.UUID `json:"message_id"`
+}
+
+type TypingPayload struct {
+	RoomID uuid.UUID `json:"room_id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+type ReadAckPayload struct {
+	RoomID    uuid.UUID `json:"room_id"`
+	MessageID uuid.UUID `json:"message_id"`
+}
+
+type ReactionRequestPayload struct {
+	MessageID uuid.UUID `json:"message_id"`
+	Emoji     string    `json:"emoji"`
+}
+
+// ReactionPayload announces a reaction added or removed by UserID. Count is
+// the emoji's new total on the message, so clients can set it as is.
+type ReactionPayload struct {
+	MessageID uuid.UUID `json:"message_id"`
+	RoomID    uuid.UUID `json:"room_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Emoji     string    `json:"emoji"`
+	Count     int64     `json:"count"`
+}
+
+type ReadReceiptPayload struct {
+	RoomID    uuid.UUID `json:"room_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	MessageID uuid.UUID `json:"message_id"`
+	ReadAt    time.Time `json:"read_at"`
+}
+
+type PresencePayload struct {
+	UserID   uuid.UUID             `json:"user_id,omitempty"`
+	Status   models.PresenceStatus `json:"status"`
+	LastSeen *time.Time            `json:"last_seen,omitempty"`
+}
+
+type MessageDeletedPayload struct {
+	ID     uuid.UUID `json:"id"`
+	RoomID uuid.UUID `json:"room_id"`
+}
+
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func newEvent(eventType EventType, roomID uuid.UUID, payload interface{}) *Event {
+	return &Event{
+		Version: ProtocolVersion,
+		Type:    eventType,
+		RoomID:  roomID,
+		Payload: payload,
+	}
+}
+
+// newMessageEvent addresses an event about a message to its room, or only to
+// the sender while the message is withheld for attachment scanning
+func newMessageEvent(eventType EventType, message *models.Message, payload interface{}) *Event {
+	event := newEvent(eventType, message.RoomID, payload)
+	if message.IsWithheld() {
+		event.Recipients = []uuid.UUID{message.SenderID}
+	}
+	return event
+}
+
+func NewMessageEvent(message *models.Message) *Event {
+	return newMessageEvent(EventMessageNew, message, MessageFromModel(message))
+}
+
+func NewMessageUpdatedEvent(message *models.Message) *Event {
+	return newMessageEvent(EventMessageUpdated, message, MessageFromModel(message))
+}
+
+func NewMessageDeletedEvent(message *models.Message) *Event {
+	return newMessageEvent(EventMessageDeleted, message, MessageDeletedPayload{
+		ID:     message.ID,
+		RoomID: message.RoomID,
+	})
+}
+
+func NewReadReceiptEvent(read *models.RoomRead) *Event {
+	return newEvent(EventReadReceipt, read.RoomID, ReadReceiptPayload{
+		RoomID:    read.RoomID,
+		UserID:    read.UserID,
+		MessageID: read.LastReadMessageID,
+		ReadAt:    read.LastReadAt,
+	})
+}
+
+func NewReactionAddedEvent(change *services.ReactionChange) *Event {
+	return newReactionEvent(EventReactionAdded, change)
+}
+
+func NewReactionRemovedEvent(change *services.ReactionChange) *Event {
+	return newReactionEvent(EventReactionRemoved, change)
+}
+
+func newReactionEvent(eventType EventType, change *services.ReactionChange) *Event {
+	return newMessageEvent(eventType, change.Message, ReactionPayload{
+		MessageID: change.Message.ID,
+		RoomID:    change.Message.RoomID,
+		UserID:    change.Reaction.UserID,
+		Emoji:     change.Reaction.Emoji,
+		Count:     change.Count,
+	})
+}
+
+// NewAttachmentReadyEvent tells the uploader an upload is processed, whether
+// or not that succeeded; the attachment's status tells which. Other members
+// get the attachment with its message, which is withheld until then.
+func NewAttachmentReadyEvent(attachment *models.Attachment) *Event {
+	event := newEvent(EventAttachmentReady, uuid.Nil, attachment)
+	event.Recipients = []uuid.UUID{attachment.UploaderID}
+	return event
+}
+
+// NewAckEvent confirms a client request, carrying the result of the request as its payload
+func NewAckEvent(requestID string, payload interface{}) *Event {
+	event := newEvent(EventAck, uuid.Nil, payload)
+	event.ID = requestID
+	return event
+}
+
+func NewErrorEvent(requestID, code, message string) *Event {
+	event := newEvent(EventError, uuid.Nil, ErrorPayload{
+		Code:    code,
+		Message: message,
+	})
+	event.ID = requestID
+	return event
+}
+
+// errorEventFromService converts a service error into an error frame for the client
+func errorEventFromService(requestID string, err error) *Event {
+	switch {
+	case errors.Is(err, services.ErrNotRoomMember),
+		errors.Is(err, services.ErrNotMessageSender),
+		errors.Is(err, services.ErrInsufficientRole):
+		return NewErrorEvent(requestID, ErrCodeForbidden, err.Error())
+	case errors.Is(err, services.ErrMessageNotFound),
+		errors.Is(err, services.ErrReactionNotFound),
+		errors.Is(err, services.ErrInvalidReplyTarget):
+		return NewErrorEvent(requestID, ErrCodeNotFound, err.Error())
+	case errors.Is(err, services.ErrInvalidReaction),
+		errors.Is(err, services.ErrTooManyReactions),
+		errors.Is(err, services.ErrInvalidMessageType),
+		errors.Is(err, services.ErrInvalidAttachment),
+		errors.Is(err, services.ErrTooManyAttachments):
+		return NewErrorEvent(requestID, ErrCodeInvalidPayload, err.Error())
+	default:
+		return NewErrorEvent(requestID, ErrCodeInternal, "failed to process request")
+	}
+}
@@ -1,21 +1,49 @@
 package websocket
 
 import (
+	"context"
+	"log"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+	"github.com/kevinsofyan/echoes-chat-api/internal/services"
 )
 
+const membershipLoadTimeout = 5 * time.Second
+
 type Hub struct {
-	clients map[uuid.UUID]*Client
+	// clients holds every open connection per user, so a user can be online on several devices
+	clients map[uuid.UUID]map[*Client]struct{}
+
+	// rooms maps a room ID to the connected users subscribed to it
+	rooms map[uuid.UUID]map[uuid.UUID]struct{}
+
+	// userRooms is the reverse index of rooms, used to unsubscribe a user on disconnect
+	userRooms map[uuid.UUID]map[uuid.UUID]struct{}
+
+	// typing holds the active typing indicators and their expiry timers
+	typing map[typingKey]*typingEntry
 
-	Broadcast chan *Message
+	// presence is the last status announced for each connected user
+	presence map[uuid.UUID]models.PresenceStatus
+
+	// pendingPresence holds the online state to save for each user, guarded by
+	// presenceMu; presenceSignal wakes the writer
+	pendingPresence map[uuid.UUID]bool
+	presenceSignal  chan struct{}
+	presenceMu      sync.Mutex
+
+	Broadcast chan *Event
 
 	Register chan *Client
 
 	Unregister chan *Client
 	mu         sync.RWMutex
+
+	roomService services.RoomService
+	userService services.UserService
 }
 
 type Message struct {
@@ -26,49 +54,324 @@ type Message struct {
 	Type      string     `json:"type"` // "text", "image", "file", "video", "audio"
 	FileURL   string     `json:"file_url,omitempty"`
 	ReplyToID *uuid.UUID `json:"reply_to_id,omitempty"`
+	IsEdited  bool       `json:"is_edited"`
 	CreatedAt time.Time  `json:"created_at,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at,omitempty"`
+
+	Attachments []models.Attachment `json:"attachments,omitempty"`
 }
 
-func NewHub() *Hub {
+func MessageFromModel(message *models.Message) *Message {
+	return &Message{
+		ID:        message.ID,
+		RoomID:    message.RoomID,
+		SenderID:  message.SenderID,
+		Content:   message.Content,
+		Type:      string(message.Type),
+		FileURL:   message.FileURL,
+		ReplyToID: message.ReplyToID,
+		IsEdited:  message.IsEdited,
+		CreatedAt: message.CreatedAt,
+		UpdatedAt: message.UpdatedAt,
+
+		Attachments: message.Attachments,
+	}
+}
+
+func NewHub(roomService services.RoomService, userService services.UserService) *Hub {
 	return &Hub{
-		clients:    make(map[uuid.UUID]*Client),
-		Broadcast:  make(chan *Message),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
+		clients:         make(map[uuid.UUID]map[*Client]struct{}),
+		rooms:           make(map[uuid.UUID]map[uuid.UUID]struct{}),
+		userRooms:       make(map[uuid.UUID]map[uuid.UUID]struct{}),
+		typing:          make(map[typingKey]*typingEntry),
+		presence:        make(map[uuid.UUID]models.PresenceStatus),
+		pendingPresence: make(map[uuid.UUID]bool),
+		presenceSignal:  make(chan struct{}, 1),
+		Broadcast:       make(chan *Event),
+		Register:        make(chan *Client),
+		Unregister:      make(chan *Client),
+		roomService:     roomService,
+		userService:     userService,
 	}
 }
 
 func (h *Hub) Run() {
+	go h.persistPresence()
+
+	idleTicker := time.NewTicker(idleCheckInterval)
+	defer idleTicker.Stop()
+
 	for {
 		select {
 		case client := <-h.Register:
 			h.mu.Lock()
-			h.clients[client.UserID] = client
+			connections, online := h.clients[client.UserID]
+			if !online {
+				connections = make(map[*Client]struct{})
+				h.clients[client.UserID] = connections
+			}
+			connections[client] = struct{}{}
+
+			if online {
+				// An extra device may bring the user back from away
+				h.refreshPresence(client.UserID)
+			} else {
+				h.queuePresenceWrite(client.UserID, true)
+			}
 			h.mu.Unlock()
 
+			// Memberships are shared by all of a user's connections, so only load them once.
+			// This runs outside the run loop so a slow query doesn't stall delivery.
+			if !online {
+				go h.loadMemberships(client.UserID)
+			}
+
 		case client := <-h.Unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client.UserID]; ok {
-				delete(h.clients, client.UserID)
-				close(client.send)
-			}
+			h.removeClient(client)
 			h.mu.Unlock()
 
-		case message := <-h.Broadcast:
-			h.mu.RLock()
-			for _, client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client.UserID)
-				}
+		case event := <-h.Broadcast:
+			h.mu.Lock()
+			h.deliver(event)
+			h.mu.Unlock()
+
+		case now := <-idleTicker.C:
+			h.mu.Lock()
+			h.markIdleClients(now)
+			h.mu.Unlock()
+		}
+	}
+}
+
+// deliver sends an event to its recipients, or to the members of its room.
+// Connections too slow to keep up are dropped once delivery is done.
+// It must be called with h.mu held.
+func (h *Hub) deliver(event *Event) {
+	var slow []*Client
+	send := func(userID uuid.UUID) {
+		if userID == event.ExcludeUserID {
+			return
+		}
+		for client := range h.clients[userID] {
+			select {
+			case client.send <- event:
+			default:
+				slow = append(slow, client)
+			}
+		}
+	}
+
+	if event.Recipients != nil {
+		for _, userID := range event.Recipients {
+			send(userID)
+		}
+	} else {
+		for userID := range h.rooms[event.RoomID] {
+			send(userID)
+		}
+	}
+
+	for _, client := range slow {
+		h.removeClient(client)
+	}
+}
+
+func (h *Hub) BroadcastToRoom(roomID uuid.UUID, event *Event) {
+	event.RoomID = roomID
+	h.Broadcast <- event
+}
+
+// AttachmentProcessed tells the uploader about a processed upload, implementing services.AttachmentNotifier
+func (h *Hub) AttachmentProcessed(attachment *models.Attachment) {
+	h.Broadcast <- NewAttachmentReadyEvent(attachment)
+}
+
+// MessageReleased delivers a message that was withheld until its attachments
+// were cleared, implementing services.AttachmentNotifier
+func (h *Hub) MessageReleased(message *models.Message) {
+	h.Broadcast <- NewMessageEvent(message)
+}
+
+// SendToClient delivers an event to a single connection, such as an error for a rejected request
+func (h *Hub) SendToClient(client *Client, event *Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// The connection may already have been dropped and its channel closed
+	if _, ok := h.clients[client.UserID][client]; !ok {
+		return
+	}
+
+	select {
+	case client.send <- event:
+	default:
+		h.removeClient(client)
+	}
+}
+
+// AddRoomMember subscribes a connected user to a room's messages.
+// It is a no-op for users without an active connection; their rooms are loaded on connect.
+func (h *Hub) AddRoomMember(roomID, userID uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[userID]; !ok {
+		return
+	}
+	h.subscribe(roomID, userID)
+}
+
+// RemoveRoomMember stops delivering a room's messages to a user.
+func (h *Hub) RemoveRoomMember(roomID, userID uuid.UUID) {
+	h.mu.Lock()
+	stoppedTyping := h.clearTyping(typingKey{roomID: roomID, userID: userID})
+	h.unsubscribe(roomID, userID)
+	h.mu.Unlock()
+
+	if stoppedTyping {
+		h.Broadcast <- newTypingEvent(EventTypingStop, roomID, userID)
+	}
+}
+
+func (h *Hub) loadMemberships(userID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), membershipLoadTimeout)
+	defer cancel()
+
+	roomIDs, err := h.roomService.GetUserRoomIDs(ctx, userID)
+	if err != nil {
+		log.Printf("error loading rooms for user %s: %v", userID, err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// The user may have disconnected while the query was running
+	if _, ok := h.clients[userID]; !ok {
+		return
+	}
+	for _, roomID := range roomIDs {
+		h.subscribe(roomID, userID)
+	}
+
+	// Co-members are only known now, so announce the user even if their status was already recorded
+	h.announcePresence(userID, h.presenceOf(userID))
+	h.sendPresenceSnapshot(userID)
+}
+
+// IsOnline reports whether the user has at least one open connection
+func (h *Hub) IsOnline(userID uuid.UUID) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	_, ok := h.clients[userID]
+	return ok
+}
+
+// removeClient must be called with h.mu held.
+// The user is only considered offline once their last connection is removed.
+func (h *Hub) removeClient(client *Client) {
+	connections, ok := h.clients[client.UserID]
+	if !ok {
+		return
+	}
+	if _, ok := connections[client]; !ok {
+		return
+	}
+	delete(connections, client)
+	close(client.send)
+
+	if len(connections) > 0 {
+		return
+	}
+	delete(h.clients, client.UserID)
+	h.clearUserTyping(client.UserID)
+
+	// Announce before unsubscribing, while co-members are still known
+	h.refreshPresence(client.UserID)
+	h.queuePresenceWrite(client.UserID, false)
+
+	for roomID := range h.userRooms[client.UserID] {
+		h.unsubscribe(roomID, client.UserID)
+	}
+}
+
+// subscribe must be called with h.mu held
+func (h *Hub) subscribe(roomID, userID uuid.UUID) {
+	if h.rooms[roomID] == nil {
+		h.rooms[roomID] = make(map[uuid.UUID]struct{})
+	}
+	h.rooms[roomID][userID] = struct{}{}
+
+	if h.userRooms[userID] == nil {
+		h.userRooms[userID] = make(map[uuid.UUID]struct{})
+	}
+	h.userRooms[userID][roomID] = struct{}{}
+}
+
+// unsubscribe must be called with h.mu held
+func (h *Hub) unsubscribe(roomID, userID uuid.UUID) {
+	if members, ok := h.rooms[roomID]; ok {
+		delete(members, userID)
+		if len(members) == 0 {
+			delete(h.rooms, roomID)
+		}
+	}
+
+	if rooms, ok := h.userRooms[userID]; ok {
+		delete(rooms, roomID)
+		if len(rooms) == 0 {
+			delete(h.userRooms, userID)
+		}
+	}
+}
+
+// TerminateTokenSessions closes every connection opened with the given token
+func (h *Hub) TerminateTokenSessions(tokenID uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, connections := range h.clients {
+		for client := range connections {
+			if client.TokenID == tokenID {
+				h.terminateClient(client)
 			}
-			h.mu.RUnlock()
 		}
 	}
 }
 
-func (h *Hub) BroadcastToRoom(roomID uuid.UUID, message *Message) {
-	h.Broadcast <- message
+// TerminateSession closes every connection opened by a signed-in device
+func (h *Hub) TerminateSession(sessionID uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, connections := range h.clients {
+		for client := range connections {
+			if client.SessionID == sessionID {
+				h.terminateClient(client)
+			}
+		}
+	}
+}
+
+// TerminateUserSessions closes all of a user's connections
+func (h *Hub) TerminateUserSessions(userID uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.clients[userID] {
+		h.terminateClient(client)
+	}
+}
+
+// terminateClient tells the client why before closing the connection; the
+// error frame is written ahead of the close frame since send is drained first.
+// It must be called with h.mu held.
+func (h *Hub) terminateClient(client *Client) {
+	select {
+	case client.send <- NewErrorEvent("", ErrCodeSessionRevoked, "session has been revoked"):
+	default:
+	}
+	h.removeClient(client)
 }
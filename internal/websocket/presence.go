@@ -0,0 +1,167 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/models"
+)
+
+const (
+	// idleTimeout marks a connection away when the client has sent nothing, not even a heartbeat, for this long
+	idleTimeout       = 5 * time.Minute
+	idleCheckInterval = 30 * time.Second
+
+	presenceWriteTimeout = 5 * time.Second
+)
+
+// SetClientStatus records activity on a connection. Clients send presence.update
+// heartbeats with "away" when the user is idle and "online" when they return;
+// any other frame counts as activity. Members sharing a room with the user are
+// notified when the user's overall presence changes.
+func (h *Hub) SetClientStatus(client *Client, status models.PresenceStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[client.UserID][client]; !ok {
+		return
+	}
+
+	client.lastActive = time.Now()
+	client.status = status
+	h.refreshPresence(client.UserID)
+}
+
+// queuePresenceWrite schedules saving a user's online state without blocking,
+// since it's called with h.mu held. Only the latest state per user is kept, so
+// a slow database can't back writes up into the hub.
+func (h *Hub) queuePresenceWrite(userID uuid.UUID, online bool) {
+	h.presenceMu.Lock()
+	h.pendingPresence[userID] = online
+	h.presenceMu.Unlock()
+
+	select {
+	case h.presenceSignal <- struct{}{}:
+	default:
+		// A wake-up is already pending and will pick this write up
+	}
+}
+
+// persistPresence writes online/offline transitions to the database one at a time,
+// so a quick disconnect and reconnect can't be stored out of order
+func (h *Hub) persistPresence() {
+	for range h.presenceSignal {
+		h.presenceMu.Lock()
+		writes := h.pendingPresence
+		h.pendingPresence = make(map[uuid.UUID]bool)
+		h.presenceMu.Unlock()
+
+		for userID, online := range writes {
+			ctx, cancel := context.WithTimeout(context.Background(), presenceWriteTimeout)
+			if err := h.userService.SetOnlineStatus(ctx, userID, online); err != nil {
+				log.Printf("error saving presence for user %s: %v", userID, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// markIdleClients must be called with h.mu held
+func (h *Hub) markIdleClients(now time.Time) {
+	for userID, connections := range h.clients {
+		changed := false
+		for client := range connections {
+			if client.status == models.PresenceOnline && now.Sub(client.lastActive) > idleTimeout {
+				client.status = models.PresenceAway
+				changed = true
+			}
+		}
+		if changed {
+			h.refreshPresence(userID)
+		}
+	}
+}
+
+// presenceOf combines the user's connections: online if any of them is active,
+// away if all of them are idle, and offline once the last one has gone.
+// It must be called with h.mu held.
+func (h *Hub) presenceOf(userID uuid.UUID) models.PresenceStatus {
+	connections, ok := h.clients[userID]
+	if !ok || len(connections) == 0 {
+		return models.PresenceOffline
+	}
+	for client := range connections {
+		if client.status == models.PresenceOnline {
+			return models.PresenceOnline
+		}
+	}
+	return models.PresenceAway
+}
+
+// refreshPresence notifies co-members if the user's presence changed.
+// It must be called with h.mu held.
+func (h *Hub) refreshPresence(userID uuid.UUID) {
+	status := h.presenceOf(userID)
+	if h.presence[userID] == status {
+		return
+	}
+	h.announcePresence(userID, status)
+}
+
+// announcePresence records the user's presence and pushes it to every connected
+// user who shares a room with them. It must be called with h.mu held.
+func (h *Hub) announcePresence(userID uuid.UUID, status models.PresenceStatus) {
+	payload := PresencePayload{UserID: userID, Status: status}
+	if status == models.PresenceOffline {
+		delete(h.presence, userID)
+		now := time.Now()
+		payload.LastSeen = &now
+	} else {
+		h.presence[userID] = status
+	}
+
+	recipients := h.coMembers(userID)
+	if len(recipients) == 0 {
+		return
+	}
+
+	event := newEvent(EventPresenceUpdate, uuid.Nil, payload)
+	event.Recipients = recipients
+	h.deliver(event)
+}
+
+// sendPresenceSnapshot tells a newly connected user who among their co-members is
+// already online. It must be called with h.mu held.
+func (h *Hub) sendPresenceSnapshot(userID uuid.UUID) {
+	for _, memberID := range h.coMembers(userID) {
+		status, ok := h.presence[memberID]
+		if !ok {
+			continue
+		}
+		event := newEvent(EventPresenceUpdate, uuid.Nil, PresencePayload{UserID: memberID, Status: status})
+		event.Recipients = []uuid.UUID{userID}
+		h.deliver(event)
+	}
+}
+
+// coMembers returns the connected users sharing at least one room with the user.
+// It must be called with h.mu held.
+func (h *Hub) coMembers(userID uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]struct{})
+	var members []uuid.UUID
+	for roomID := range h.userRooms[userID] {
+		for memberID := range h.rooms[roomID] {
+			if memberID == userID {
+				continue
+			}
+			if _, ok := seen[memberID]; ok {
+				continue
+			}
+			seen[memberID] = struct{}{}
+			members = append(members, memberID)
+		}
+	}
+	return members
+}
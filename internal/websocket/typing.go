@@ -0,0 +1,106 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinsofyan/echoes-chat-api/internal/services"
+)
+
+// typingTimeout clears an indicator the client never stopped, e.g. after a dropped connection.
+// Clients should resend typing.start more often than this while the user keeps typing.
+const typingTimeout = 6 * time.Second
+
+type typingKey struct {
+	roomID uuid.UUID
+	userID uuid.UUID
+}
+
+type typingEntry struct {
+	timer *time.Timer
+}
+
+// StartTyping marks the user as typing in a room and notifies the other members.
+// Repeated calls only extend the expiry.
+func (h *Hub) StartTyping(roomID, userID uuid.UUID) error {
+	h.mu.Lock()
+
+	if _, ok := h.rooms[roomID][userID]; !ok {
+		h.mu.Unlock()
+		return services.ErrNotRoomMember
+	}
+
+	key := typingKey{roomID: roomID, userID: userID}
+	if entry, ok := h.typing[key]; ok && entry.timer.Stop() {
+		entry.timer.Reset(typingTimeout)
+		h.mu.Unlock()
+		return nil
+	}
+
+	entry := &typingEntry{}
+	entry.timer = time.AfterFunc(typingTimeout, func() {
+		h.expireTyping(key, entry)
+	})
+	h.typing[key] = entry
+	h.mu.Unlock()
+
+	h.Broadcast <- newTypingEvent(EventTypingStart, roomID, userID)
+	return nil
+}
+
+// StopTyping clears the user's typing indicator in a room, if any
+func (h *Hub) StopTyping(roomID, userID uuid.UUID) {
+	h.mu.Lock()
+	stopped := h.clearTyping(typingKey{roomID: roomID, userID: userID})
+	h.mu.Unlock()
+
+	if stopped {
+		h.Broadcast <- newTypingEvent(EventTypingStop, roomID, userID)
+	}
+}
+
+func (h *Hub) expireTyping(key typingKey, entry *typingEntry) {
+	h.mu.Lock()
+	// A newer indicator may have replaced this one after the timer fired
+	if h.typing[key] != entry {
+		h.mu.Unlock()
+		return
+	}
+	h.clearTyping(key)
+	h.mu.Unlock()
+
+	h.Broadcast <- newTypingEvent(EventTypingStop, key.roomID, key.userID)
+}
+
+// clearTyping must be called with h.mu held
+func (h *Hub) clearTyping(key typingKey) bool {
+	entry, ok := h.typing[key]
+	if !ok {
+		return false
+	}
+	entry.timer.Stop()
+	delete(h.typing, key)
+	return true
+}
+
+// clearUserTyping drops every indicator for a user who went offline.
+// It must be called with h.mu held, from inside the run loop, so the
+// notifications are sent asynchronously.
+func (h *Hub) clearUserTyping(userID uuid.UUID) {
+	for roomID := range h.userRooms[userID] {
+		if h.clearTyping(typingKey{roomID: roomID, userID: userID}) {
+			event := newTypingEvent(EventTypingStop, roomID, userID)
+			go func() { h.Broadcast <- event }()
+		}
+	}
+}
+
+func newTypingEvent(eventType EventType, roomID, userID uuid.UUID) *Event {
+	event := newEvent(eventType, roomID, TypingPayload{
+		RoomID: roomID,
+		UserID: userID,
+	})
+	// The typist doesn't need their own indicator echoed back
+	event.ExcludeUserID = userID
+	return event
+}
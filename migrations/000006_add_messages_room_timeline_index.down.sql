@@ -0,0 +1,3 @@
+SET search_path TO echoes_chat;
+
+DROP INDEX IF EXISTS idx_messages_room_created_at_id;
@@ -0,0 +1,3 @@
+SET search_path TO echoes_chat;
+
+CREATE INDEX IF NOT EXISTS idx_messages_room_created_at_id ON messages(room_id, created_at, id);
@@ -0,0 +1,4 @@
+SET search_path TO echoes_chat;
+
+DROP TRIGGER IF EXISTS update_room_reads_updated_at ON room_reads;
+DROP TABLE IF EXISTS room_reads;
@@ -0,0 +1,19 @@
+SET search_path TO echoes_chat;
+
+CREATE TABLE IF NOT EXISTS room_reads (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_read_message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    last_read_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (room_id, user_id)
+);
+
+CREATE INDEX idx_room_reads_user_id ON room_reads(user_id);
+CREATE INDEX idx_room_reads_deleted_at ON room_reads(deleted_at);
+
+CREATE TRIGGER update_room_reads_updated_at BEFORE UPDATE ON room_reads
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,5 @@
+SET search_path TO echoes_chat;
+
+DROP INDEX IF EXISTS idx_tokens_jti;
+
+ALTER TABLE tokens DROP COLUMN IF EXISTS jti;
@@ -0,0 +1,5 @@
+SET search_path TO echoes_chat;
+
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS jti UUID;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tokens_jti ON tokens(jti);
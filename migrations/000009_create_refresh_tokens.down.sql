@@ -0,0 +1,4 @@
+SET search_path TO echoes_chat;
+
+DROP TRIGGER IF EXISTS update_refresh_tokens_updated_at ON refresh_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
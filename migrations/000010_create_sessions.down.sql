@@ -0,0 +1,7 @@
+SET search_path TO echoes_chat;
+
+DROP INDEX IF EXISTS idx_tokens_session_id;
+ALTER TABLE tokens DROP COLUMN IF EXISTS session_id;
+
+DROP TRIGGER IF EXISTS update_sessions_updated_at ON sessions;
+DROP TABLE IF EXISTS sessions;
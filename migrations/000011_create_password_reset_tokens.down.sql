@@ -0,0 +1,4 @@
+SET search_path TO echoes_chat;
+
+DROP TRIGGER IF EXISTS update_password_reset_tokens_updated_at ON password_reset_tokens;
+DROP TABLE IF EXISTS password_reset_tokens;
@@ -0,0 +1,6 @@
+SET search_path TO echoes_chat;
+
+DROP TRIGGER IF EXISTS update_email_verification_tokens_updated_at ON email_verification_tokens;
+DROP TABLE IF EXISTS email_verification_tokens;
+
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
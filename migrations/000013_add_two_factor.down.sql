@@ -0,0 +1,11 @@
+SET search_path TO echoes_chat;
+
+DROP TRIGGER IF EXISTS update_two_factor_challenges_updated_at ON two_factor_challenges;
+DROP TABLE IF EXISTS two_factor_challenges;
+
+DROP TRIGGER IF EXISTS update_recovery_codes_updated_at ON recovery_codes;
+DROP TABLE IF EXISTS recovery_codes;
+
+ALTER TABLE users DROP COLUMN IF EXISTS two_factor_last_step;
+ALTER TABLE users DROP COLUMN IF EXISTS two_factor_enabled_at;
+ALTER TABLE users DROP COLUMN IF EXISTS two_factor_secret;
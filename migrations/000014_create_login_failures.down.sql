@@ -0,0 +1,3 @@
+SET search_path TO echoes_chat;
+
+DROP TABLE IF EXISTS login_failures;
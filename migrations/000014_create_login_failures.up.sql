@@ -0,0 +1,15 @@
+SET search_path TO echoes_chat;
+
+CREATE TABLE IF NOT EXISTS login_failures (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    email VARCHAR(100) NOT NULL,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    reason VARCHAR(30) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_login_failures_user_id ON login_failures(user_id);
+CREATE INDEX idx_login_failures_ip_address ON login_failures(ip_address);
+CREATE INDEX idx_login_failures_created_at ON login_failures(created_at);
@@ -0,0 +1,7 @@
+SET search_path TO echoes_chat;
+
+DROP TRIGGER IF EXISTS update_oidc_login_states_updated_at ON oidc_login_states;
+DROP TABLE IF EXISTS oidc_login_states;
+
+DROP TRIGGER IF EXISTS update_oidc_identities_updated_at ON oidc_identities;
+DROP TABLE IF EXISTS oidc_identities;
@@ -0,0 +1,34 @@
+SET search_path TO echoes_chat;
+
+-- A user signs in through a provider by the provider's subject, not by email,
+-- so a changed email at the provider still reaches the same account
+CREATE TABLE IF NOT EXISTS oidc_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(100),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider)
+);
+
+CREATE TRIGGER update_oidc_identities_updated_at BEFORE UPDATE ON oidc_identities
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Holds the PKCE verifier and nonce between the redirect to the provider and the callback
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    provider VARCHAR(50) NOT NULL,
+    state_hash VARCHAR(64) NOT NULL UNIQUE,
+    code_verifier VARCHAR(128) NOT NULL,
+    nonce VARCHAR(128) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_oidc_login_states_updated_at BEFORE UPDATE ON oidc_login_states
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
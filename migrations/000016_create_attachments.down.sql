@@ -0,0 +1,7 @@
+SET search_path TO echoes_chat;
+
+DROP TRIGGER IF EXISTS update_upload_sessions_updated_at ON upload_sessions;
+DROP TABLE IF EXISTS upload_sessions;
+
+DROP TRIGGER IF EXISTS update_attachments_updated_at ON attachments;
+DROP TABLE IF EXISTS attachments;
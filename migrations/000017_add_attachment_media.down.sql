@@ -0,0 +1,14 @@
+SET search_path TO echoes_chat;
+
+DROP INDEX IF EXISTS idx_attachments_processing;
+
+ALTER TABLE attachments DROP COLUMN IF EXISTS processed_at;
+ALTER TABLE attachments DROP COLUMN IF EXISTS thumbnail_height;
+ALTER TABLE attachments DROP COLUMN IF EXISTS thumbnail_width;
+ALTER TABLE attachments DROP COLUMN IF EXISTS thumbnail_content_type;
+ALTER TABLE attachments DROP COLUMN IF EXISTS thumbnail_key;
+ALTER TABLE attachments DROP COLUMN IF EXISTS blurhash;
+ALTER TABLE attachments DROP COLUMN IF EXISTS duration_ms;
+ALTER TABLE attachments DROP COLUMN IF EXISTS height;
+ALTER TABLE attachments DROP COLUMN IF EXISTS width;
+ALTER TABLE attachments DROP COLUMN IF EXISTS status;
@@ -0,0 +1,18 @@
+SET search_path TO echoes_chat;
+
+-- Files uploaded before processing existed are served as they are
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'ready';
+ALTER TABLE attachments ALTER COLUMN status SET DEFAULT 'processing';
+
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS width INTEGER;
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS height INTEGER;
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS duration_ms BIGINT;
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS blurhash VARCHAR(100);
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS thumbnail_key VARCHAR(255);
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS thumbnail_content_type VARCHAR(100);
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS thumbnail_width INTEGER;
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS thumbnail_height INTEGER;
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS processed_at TIMESTAMP WITH TIME ZONE;
+
+-- Lets a restarted server find the files it hadn't finished processing
+CREATE INDEX idx_attachments_processing ON attachments(created_at) WHERE status = 'processing';
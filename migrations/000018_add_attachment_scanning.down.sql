@@ -0,0 +1,6 @@
+SET search_path TO echoes_chat;
+
+DROP INDEX IF EXISTS idx_attachments_uncleared;
+
+ALTER TABLE attachments DROP COLUMN IF EXISTS scan_signature;
+ALTER TABLE attachments DROP COLUMN IF EXISTS scanned_at;
@@ -0,0 +1,8 @@
+SET search_path TO echoes_chat;
+
+-- Files uploaded before scanning existed are left as they are
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS scanned_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS scan_signature VARCHAR(255);
+
+-- Lets history queries skip messages held back until their attachments are cleared
+CREATE INDEX idx_attachments_uncleared ON attachments(message_id) WHERE status IN ('processing', 'quarantined');
@@ -0,0 +1,14 @@
+SET search_path TO echoes_chat;
+
+-- Reactions are removed outright rather than soft deleted, so reacting again
+-- with the same emoji doesn't collide with an old row
+CREATE TABLE IF NOT EXISTS message_reactions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    emoji VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (message_id, user_id, emoji)
+);
+
+CREATE INDEX idx_message_reactions_user_id ON message_reactions(user_id);
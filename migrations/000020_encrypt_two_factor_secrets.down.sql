@@ -0,0 +1,8 @@
+SET search_path TO echoes_chat;
+
+-- Sealed secrets don't fit the old column and can't be read by older versions,
+-- so two-factor is turned off for those accounts
+UPDATE users SET two_factor_secret = NULL, two_factor_enabled_at = NULL, two_factor_last_step = NULL
+WHERE two_factor_secret LIKE 'v1:%';
+
+ALTER TABLE users ALTER COLUMN two_factor_secret TYPE VARCHAR(64);
@@ -0,0 +1,9 @@
+SET search_path TO echoes_chat;
+
+-- Secrets are now sealed with SECRET_ENCRYPTION_KEY, which makes them longer than
+-- the plaintext. Secrets of enabled accounts are sealed by the app the next time
+-- they're used; pending setups are dropped so no new plaintext stays behind.
+ALTER TABLE users ALTER COLUMN two_factor_secret TYPE TEXT;
+
+UPDATE users SET two_factor_secret = NULL, two_factor_last_step = NULL
+WHERE two_factor_enabled_at IS NULL AND two_factor_secret IS NOT NULL;